@@ -0,0 +1,104 @@
+package forms
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimeFormats are used to parse time.Time fields without a format tag.
+// They match the values of date, datetime-local and time inputs.
+var DefaultTimeFormats = []string{"2006-01-02", "2006-01-02T15:04", "2006-01-02T15:04:05", time.RFC3339, "15:04"}
+
+// DefaultLocation is the time zone of submitted times without a time zone offset,
+// which is the case for date, datetime-local and time inputs.
+var DefaultLocation = time.Local
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// bindError is caused by an invalid value, which is reported to the user.
+type bindError struct {
+	message string
+}
+
+func (e *bindError) Error() string {
+	return e.message
+}
+
+func bindValue(fv reflect.Value, raw []string, format string) error {
+	if fv.Kind() == reflect.Slice {
+		slice := reflect.MakeSlice(fv.Type(), len(raw), len(raw))
+		for i, s := range raw {
+			if err := bindScalar(slice.Index(i), s, format); err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+		return nil
+	}
+	if len(raw) == 0 {
+		return nil
+	}
+	if fv.Kind() == reflect.Bool {
+		// A checked checkbox follows the hidden input with its unchecked value:
+		return bindScalar(fv, raw[len(raw)-1], format)
+	}
+	return bindScalar(fv, raw[0], format)
+}
+
+func bindScalar(fv reflect.Value, s string, format string) error {
+	if fv.Kind() != reflect.String {
+		s = strings.TrimSpace(s)
+	}
+
+	if fv.Type() == timeType {
+		formats := DefaultTimeFormats
+		if format != "" {
+			formats = []string{format}
+		}
+		for _, f := range formats {
+			if t, err := time.ParseInLocation(f, s, DefaultLocation); err == nil {
+				fv.Set(reflect.ValueOf(t))
+				return nil
+			}
+		}
+		return &bindError{message: "must be a valid date"}
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Bool:
+		switch strings.ToLower(s) {
+		case "on", "true", "1", "yes":
+			fv.SetBool(true)
+		case "off", "false", "0", "no":
+			fv.SetBool(false)
+		default:
+			return &bindError{message: "must be true or false"}
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, fv.Type().Bits())
+		if err != nil {
+			return &bindError{message: "must be a whole number"}
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, fv.Type().Bits())
+		if err != nil {
+			return &bindError{message: "must be a positive whole number"}
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, fv.Type().Bits())
+		if err != nil {
+			return &bindError{message: "must be a number"}
+		}
+		fv.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported field type %s", fv.Type())
+	}
+	return nil
+}
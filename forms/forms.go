@@ -0,0 +1,186 @@
+// Package forms binds url-encoded and multipart form values into structs and validates them.
+//
+// Fields are mapped with the form tag and validated with the rules of the validate tag:
+//
+//	type SignUp struct {
+//		Name     string    `form:"name" validate:"required,max=50"`
+//		Email    string    `form:"email,trim" validate:"required,email"`
+//		Age      int       `form:"age" validate:"min=18,max=130"`
+//		Website  string    `form:"website" validate:"url"`
+//		Birthday time.Time `form:"birthday" format:"2006-01-02"`
+//		Tags     []string  `form:"tags" validate:"max=5"`
+//		Address  Address   `form:"address"`
+//		Handle   string    `form:"handle" validate:"required,pattern=^[a-z0-9_]+$"`
+//	}
+//
+// Nested structs are bound from prefixed names (e.g. address.zip) and must not have
+// a validate tag. Fields without a form tag use the field name and fields with the
+// tag form:"-" are ignored.
+//
+// Whitespace around numbers, booleans and times is ignored. Strings are bound as submitted,
+// unless the form tag has the trim option (e.g. form:"email,trim").
+//
+// Times without a time zone offset are parsed in the DefaultLocation.
+package forms
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DefaultMaxMemory is the number of bytes of a multipart form which are kept in memory.
+const DefaultMaxMemory = 32 << 20
+
+// Errors maps the names of invalid form fields to error messages.
+type Errors map[string]string
+
+func (e Errors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	messages := make([]string, 0, len(fields))
+	for _, field := range fields {
+		messages = append(messages, field+": "+e[field])
+	}
+	return "invalid form: " + strings.Join(messages, "; ")
+}
+
+// Has returns true if the field is invalid (e.g. {{ if .Errors.Has "email" }}).
+func (e Errors) Has(field string) bool {
+	_, ok := e[field]
+	return ok
+}
+
+// Get returns the error message of a field or an empty string if it's valid.
+func (e Errors) Get(field string) string {
+	return e[field]
+}
+
+// add keeps the first error of a field, which is usually the most relevant one.
+func (e Errors) add(field, message string) {
+	if !e.Has(field) {
+		e[field] = message
+	}
+}
+
+// parse parses the form values of the request body and the query.
+func parse(r *http.Request) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		if err := r.ParseMultipartForm(DefaultMaxMemory); err != nil {
+			return fmt.Errorf("error parsing multipart form: %w", err)
+		}
+		return nil
+	}
+	if err := r.ParseForm(); err != nil {
+		return fmt.Errorf("error parsing form: %w", err)
+	}
+	return nil
+}
+
+// Bind parses the form of the request, binds it into v, which must be a pointer
+// to a struct, and validates it. The Errors are nil if the form is valid.
+//
+// Strings keep their whitespace unless the field is tagged with the trim option.
+//
+// The returned error is only set if the form couldn't be parsed or v is not supported.
+func Bind(r *http.Request, v any) (Errors, error) {
+	if err := parse(r); err != nil {
+		return nil, err
+	}
+	return BindValues(r.Form, v)
+}
+
+// BindValues is the same as Bind for form values which have been parsed already.
+func BindValues(values map[string][]string, v any) (Errors, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return nil, errors.New("error binding form: target must be a pointer to a struct")
+	}
+	errs := Errors{}
+	if err := bindStruct(values, rv.Elem(), "", errs); err != nil {
+		return nil, err
+	}
+	if len(errs) == 0 {
+		return nil, nil
+	}
+	return errs, nil
+}
+
+// fieldName returns the form name of a field and whether its values get trimmed (form:"name,trim").
+func fieldName(field reflect.StructField, prefix string) (string, bool, bool) {
+	name, options, _ := strings.Cut(field.Tag.Get("form"), ",")
+	if name == "-" || !field.IsExported() {
+		return "", false, false
+	}
+	if name == "" {
+		name = field.Name
+	}
+	if prefix != "" {
+		name = prefix + "." + name
+	}
+	return name, options == "trim", true
+}
+
+func bindStruct(values map[string][]string, rv reflect.Value, prefix string, errs Errors) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		name, trim, ok := fieldName(field, prefix)
+		if !ok {
+			continue
+		}
+		fv := rv.Field(i)
+
+		if fv.Kind() == reflect.Struct && fv.Type() != timeType {
+			if field.Tag.Get("validate") != "" {
+				return fmt.Errorf("error binding form field %s: nested structs can't be validated, validate their fields instead", name)
+			}
+			if err := bindStruct(values, fv, name, errs); err != nil {
+				return err
+			}
+			continue
+		}
+
+		rules, err := parseRules(field.Tag.Get("validate"))
+		if err != nil {
+			return fmt.Errorf("error binding form field %s: %w", name, err)
+		}
+		raw := nonEmpty(values[name])
+		if trim {
+			for i := range raw {
+				raw[i] = strings.TrimSpace(raw[i])
+			}
+		}
+		if err := bindValue(fv, raw, field.Tag.Get("format")); err != nil {
+			var bindErr *bindError
+			if errors.As(err, &bindErr) {
+				errs.add(name, bindErr.message)
+				continue
+			}
+			return fmt.Errorf("error binding form field %s: %w", name, err)
+		}
+		if message := validate(fv, len(raw) > 0, rules); message != "" {
+			errs.add(name, message)
+		}
+	}
+	return nil
+}
+
+// nonEmpty removes empty values, which browsers send for empty inputs.
+func nonEmpty(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
@@ -0,0 +1,183 @@
+package forms
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func areEqual[T comparable](t *testing.T, expected, actual T) {
+	if expected != actual {
+		t.Errorf("Expected: %v, Actual: %v", expected, actual)
+	}
+}
+
+type address struct {
+	Street string `form:"street" validate:"required"`
+	Zip    string `form:"zip" validate:"pattern=[0-9]{4,5}"`
+}
+
+type signUp struct {
+	Name     string    `form:"name" validate:"required,min=2,max=10"`
+	Email    string    `form:"email" validate:"required,email"`
+	Age      int       `form:"age" validate:"min=18,max=130"`
+	Score    float64   `form:"score"`
+	Website  string    `form:"website" validate:"url"`
+	Birthday time.Time `form:"birthday"`
+	Terms    bool      `form:"terms" validate:"required"`
+	Tags     []string  `form:"tags" validate:"max=2"`
+	Address  address   `form:"address"`
+	Internal string    `form:"-"`
+}
+
+func post(values url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func Test_Bind_Valid(t *testing.T) {
+	form := &signUp{}
+	errs, err := Bind(post(url.Values{
+		"name":           {"Ann"},
+		"email":          {"ann@example.org"},
+		"age":            {"42"},
+		"score":          {"9.5"},
+		"website":        {""},
+		"birthday":       {"1980-02-03"},
+		"terms":          {"off", "on"},
+		"tags":           {"a", "b"},
+		"address.street": {"Main St"},
+		"address.zip":    {"1234"},
+		"Internal":       {"x"},
+	}), form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	areEqual(t, 0, len(errs))
+	areEqual(t, "Ann", form.Name)
+	areEqual(t, 42, form.Age)
+	areEqual(t, 9.5, form.Score)
+	areEqual(t, true, time.Date(1980, 2, 3, 0, 0, 0, 0, time.Local).Equal(form.Birthday))
+	areEqual(t, true, form.Terms)
+	areEqual(t, 2, len(form.Tags))
+	areEqual(t, "Main St", form.Address.Street)
+	areEqual(t, "", form.Internal)
+}
+
+func Test_Bind_Invalid(t *testing.T) {
+	errs, err := Bind(post(url.Values{
+		"name":        {"A"},
+		"email":       {"ann"},
+		"age":         {"old"},
+		"website":     {"ftp://example.org"},
+		"birthday":    {"03.02.1980"},
+		"tags":        {"a", "b", "c"},
+		"address.zip": {"12a"},
+	}), &signUp{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for field, message := range map[string]string{
+		"name":           "must have at least 2 characters",
+		"email":          "must be a valid email address",
+		"age":            "must be a whole number",
+		"website":        "must be a valid URL",
+		"birthday":       "must be a valid date",
+		"terms":          "is required",
+		"tags":           "must have at most 2 items",
+		"address.street": "is required",
+		"address.zip":    "has an invalid format",
+	} {
+		areEqual(t, message, errs.Get(field))
+	}
+	areEqual(t, 9, len(errs))
+	areEqual(t, false, errs.Has("score"))
+}
+
+func Test_Bind_Multipart(t *testing.T) {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	_ = mw.WriteField("name", "Ann")
+	_ = mw.WriteField("age", "17")
+	_ = mw.Close()
+	r := httptest.NewRequest(http.MethodPost, "/", body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+
+	form := &struct {
+		Name string `form:"name"`
+		Age  int    `form:"age" validate:"min=18"`
+	}{}
+	errs, err := Bind(r, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	areEqual(t, "Ann", form.Name)
+	areEqual(t, "must be at least 18", errs.Get("age"))
+}
+
+func Test_BindValues_Whitespace(t *testing.T) {
+	form := &struct {
+		Email    string   `form:"email,trim" validate:"email"`
+		Password string   `form:"password"`
+		Tags     []string `form:",trim"`
+		Age      int      `form:"age"`
+		Terms    bool     `form:"terms"`
+	}{}
+	errs, err := BindValues(url.Values{
+		"email":    {" ann@example.org "},
+		"password": {" secret "},
+		"Tags":     {" a", "b "},
+		"age":      {" 42 "},
+		"terms":    {" on"},
+	}, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	areEqual(t, 0, len(errs))
+	areEqual(t, "ann@example.org", form.Email)
+	areEqual(t, " secret ", form.Password)
+	areEqual(t, "a|b", strings.Join(form.Tags, "|"))
+	areEqual(t, 42, form.Age)
+	areEqual(t, true, form.Terms)
+}
+
+func Test_BindValues_TimeLocation(t *testing.T) {
+	defer func(location *time.Location) { DefaultLocation = location }(DefaultLocation)
+	DefaultLocation = time.FixedZone("UTC+2", 2*60*60)
+
+	form := &struct {
+		Start  time.Time `form:"start"`
+		Offset time.Time `form:"offset"`
+	}{}
+	errs, err := BindValues(url.Values{
+		"start":  {"2022-05-01T12:30"},
+		"offset": {"2022-05-01T12:30:00Z"},
+	}, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	areEqual(t, 0, len(errs))
+	areEqual(t, time.Date(2022, 5, 1, 10, 30, 0, 0, time.UTC), form.Start.UTC())
+	areEqual(t, time.Date(2022, 5, 1, 12, 30, 0, 0, time.UTC), form.Offset.UTC())
+}
+
+func Test_BindValues_InvalidTarget(t *testing.T) {
+	_, err := BindValues(url.Values{}, signUp{})
+	areEqual(t, true, err != nil)
+
+	_, err = BindValues(url.Values{}, &struct {
+		Name string `validate:"unknown"`
+	}{})
+	areEqual(t, true, err != nil)
+
+	_, err = BindValues(url.Values{}, &struct {
+		Address address `form:"address" validate:"required"`
+	}{})
+	areEqual(t, true, err != nil)
+}
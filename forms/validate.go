@@ -0,0 +1,182 @@
+package forms
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+type rules struct {
+	required bool
+	min      *float64
+	max      *float64
+	email    bool
+	url      bool
+	pattern  *regexp.Regexp
+}
+
+// patterns caches compiled patterns, because rules get parsed on every Bind.
+var patterns sync.Map
+
+func compilePattern(expr string) (*regexp.Regexp, error) {
+	if re, ok := patterns.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+	patterns.Store(expr, re)
+	return re, nil
+}
+
+// parseRules parses a validate tag. The pattern rule must come last,
+// because the pattern itself may contain commas.
+func parseRules(tag string) (rules, error) {
+	r := rules{}
+	for tag != "" {
+		var rule string
+		if strings.HasPrefix(tag, "pattern=") {
+			rule, tag = tag, ""
+		} else if i := strings.Index(tag, ","); i >= 0 {
+			rule, tag = tag[:i], tag[i+1:]
+		} else {
+			rule, tag = tag, ""
+		}
+
+		name, arg := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, arg = rule[:i], rule[i+1:]
+		}
+		switch strings.TrimSpace(name) {
+		case "required":
+			r.required = true
+		case "email":
+			r.email = true
+		case "url":
+			r.url = true
+		case "min", "max":
+			n, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return r, fmt.Errorf("invalid %s rule: %w", name, err)
+			}
+			if name == "min" {
+				r.min = &n
+			} else {
+				r.max = &n
+			}
+		case "pattern":
+			re, err := compilePattern(arg)
+			if err != nil {
+				return r, err
+			}
+			r.pattern = re
+		case "":
+		default:
+			return r, fmt.Errorf("unknown validation rule %s", name)
+		}
+	}
+	return r, nil
+}
+
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+func plural(n float64, word string) string {
+	if n == 1 {
+		return "1 " + word
+	}
+	return formatNumber(n) + " " + word + "s"
+}
+
+// checkRange applies min and max to a number, the length of a string or the size of a slice.
+func checkRange(r rules, n float64, unit string) string {
+	describe := func(limit float64) string {
+		if unit == "" {
+			return formatNumber(limit)
+		}
+		return plural(limit, unit)
+	}
+	if r.min != nil && n < *r.min {
+		if unit == "" {
+			return "must be at least " + describe(*r.min)
+		}
+		return "must have at least " + describe(*r.min)
+	}
+	if r.max != nil && n > *r.max {
+		if unit == "" {
+			return "must be at most " + describe(*r.max)
+		}
+		return "must have at most " + describe(*r.max)
+	}
+	return ""
+}
+
+func validEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Address == s && strings.Contains(s[strings.LastIndex(s, "@"):], ".")
+}
+
+func validURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func validateString(s string, r rules) string {
+	if message := checkRange(r, float64(utf8.RuneCountInString(s)), "character"); message != "" {
+		return message
+	}
+	if r.email && !validEmail(s) {
+		return "must be a valid email address"
+	}
+	if r.url && !validURL(s) {
+		return "must be a valid URL"
+	}
+	if r.pattern != nil && !r.pattern.MatchString(s) {
+		return "has an invalid format"
+	}
+	return ""
+}
+
+// validate returns an error message if the bound value doesn't satisfy the rules.
+// Optional fields which haven't been submitted are always valid.
+func validate(fv reflect.Value, submitted bool, r rules) string {
+	if !submitted || (fv.Kind() == reflect.Bool && !fv.Bool()) {
+		if r.required {
+			return "is required"
+		}
+		return ""
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		return validateString(fv.String(), r)
+	case reflect.Slice:
+		if message := checkRange(r, float64(fv.Len()), "item"); message != "" {
+			return message
+		}
+		if fv.Type().Elem().Kind() == reflect.String {
+			for i := 0; i < fv.Len(); i++ {
+				element := r
+				element.min, element.max = nil, nil
+				if message := validateString(fv.Index(i).String(), element); message != "" {
+					return message
+				}
+			}
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return checkRange(r, float64(fv.Int()), "")
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return checkRange(r, float64(fv.Uint()), "")
+	case reflect.Float32, reflect.Float64:
+		return checkRange(r, fv.Float(), "")
+	}
+	return ""
+}
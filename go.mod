@@ -2,9 +2,14 @@ module github.com/dusted-go/http/v6
 
 go 1.18
 
-require github.com/tdewolff/minify v2.3.6+incompatible
+require (
+	github.com/tdewolff/minify v2.3.6+incompatible
+	golang.org/x/crypto v0.17.0
+	golang.org/x/net v0.19.0
+)
 
 require (
 	github.com/tdewolff/parse v2.3.4+incompatible // indirect
 	github.com/tdewolff/test v1.0.9 // indirect
+	golang.org/x/text v0.14.0 // indirect
 )
@@ -4,13 +4,24 @@ import (
 	"fmt"
 	"html/template"
 	"net/http"
+	"path/filepath"
+
+	"github.com/dusted-go/http/v6/middleware/headers"
 )
 
+// nonceFunc is the name of the template function which returns the CSP nonce
+// of the current request (e.g. <script nonce="{{ cspNonce }}">).
+const nonceFunc = "cspNonce"
+
 type Writer struct {
 	hotReload     bool
 	layoutName    string
 	templateFiles map[string][]string
 	templates     map[string]*template.Template
+
+	// pristine templates never get executed, because a template
+	// can't be cloned anymore once it has been executed.
+	pristine map[string]*template.Template
 }
 
 func (hw *Writer) WriteView(
@@ -18,18 +29,54 @@ func (hw *Writer) WriteView(
 	statusCode int,
 	key string,
 	model interface{},
+) error {
+	return hw.writeView(w, statusCode, key, model, "")
+}
+
+// WriteRequestView is the same as WriteView, except that the cspNonce
+// template function returns the nonce which has been generated by the
+// headers.SecurityPolicy middleware for the given request.
+func (hw *Writer) WriteRequestView(
+	w http.ResponseWriter,
+	r *http.Request,
+	statusCode int,
+	key string,
+	model interface{},
+) error {
+	return hw.writeView(w, statusCode, key, model, headers.GetNonce(r.Context()))
+}
+
+func (hw *Writer) writeView(
+	w http.ResponseWriter,
+	statusCode int,
+	key string,
+	model interface{},
+	nonce string,
 ) error {
 	var t *template.Template
 
 	// In production settings use pre-created templates,
 	// otherwise create a new template every time during
 	// for a faster feedback loop during development:
-	if hw.hotReload {
+	switch {
+	case hw.hotReload:
 		t = createTemplate(hw.templateFiles[key]...)
-	} else {
+	case nonce != "":
+		t = hw.pristine[key]
+	default:
 		t = hw.templates[key]
 	}
 
+	if nonce != "" {
+		clone, err := t.Clone()
+		if err != nil {
+			return fmt.Errorf("error cloning template with key '%s': %w", key, err)
+		}
+		t = clone.Funcs(template.FuncMap{
+			nonceFunc: func() string { return nonce },
+		})
+	}
+
 	w.WriteHeader(statusCode)
 	err := t.ExecuteTemplate(w, hw.layoutName, model)
 
@@ -46,8 +93,10 @@ func NewWriter(
 ) *Writer {
 
 	templates := make(map[string]*template.Template)
+	pristine := make(map[string]*template.Template)
 	for key, files := range templateFiles {
 		templates[key] = createTemplate(files...)
+		pristine[key] = template.Must(templates[key].Clone())
 	}
 
 	return &Writer{
@@ -55,9 +104,16 @@ func NewWriter(
 		layoutName:    layoutName,
 		templateFiles: templateFiles,
 		templates:     templates,
+		pristine:      pristine,
 	}
 }
 
 func createTemplate(files ...string) *template.Template {
-	return template.Must(template.ParseFiles(files...))
+	if len(files) == 0 {
+		panic("htmlview: no template files given")
+	}
+	t := template.New(filepath.Base(files[0])).Funcs(template.FuncMap{
+		nonceFunc: func() string { return "" },
+	})
+	return template.Must(t.ParseFiles(files...))
 }
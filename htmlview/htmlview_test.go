@@ -0,0 +1,72 @@
+package htmlview
+
+import (
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dusted-go/http/v6/middleware/headers"
+)
+
+func areEqual[T comparable](t *testing.T, expected, actual T) {
+	if expected != actual {
+		t.Errorf("Expected: %v, Actual: %v", expected, actual)
+	}
+}
+
+func newTestWriter(t *testing.T, hotReload bool) *Writer {
+	dir := t.TempDir()
+	layout := filepath.Join(dir, "layout.html")
+	index := filepath.Join(dir, "index.html")
+	err := os.WriteFile(layout, []byte(`{{ define "layout" }}<script nonce="{{ cspNonce }}"></script>{{ template "content" . }}{{ end }}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(index, []byte(`{{ define "content" }}<p>{{ . }}</p>{{ end }}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewWriter(hotReload, "layout", map[string][]string{"index": {layout, index}})
+}
+
+func Test_WriteView_WithAndWithoutNonce(t *testing.T) {
+	for _, hotReload := range []bool{false, true} {
+		hw := newTestWriter(t, hotReload)
+
+		// Render without a nonce first, which executes the pre-created template:
+		w := httptest.NewRecorder()
+		if err := hw.WriteView(w, http.StatusOK, "index", "hello"); err != nil {
+			t.Fatal(err)
+		}
+		areEqual(t, `<script nonce=""></script><p>hello</p>`, w.Body.String())
+
+		var nonce string
+		handler := headers.SecurityPolicy(&headers.Policy{
+			CSP: &headers.CSP{Directives: map[string][]string{"script-src": {headers.Nonce}}},
+		})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			nonce = headers.GetNonce(r.Context())
+			if err := hw.WriteRequestView(w, r, http.StatusCreated, "index", "world"); err != nil {
+				t.Fatal(err)
+			}
+		}))
+		for i := 0; i < 2; i++ {
+			w = httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			areEqual(t, http.StatusCreated, w.Code)
+			areEqual(t, true, nonce != "")
+			areEqual(t, `<script nonce="`+nonce+`"></script><p>world</p>`, html.UnescapeString(w.Body.String()))
+			areEqual(t, true, strings.Contains(w.Header().Get("Content-Security-Policy"), nonce))
+		}
+
+		// The nonce must not leak into views without one:
+		w = httptest.NewRecorder()
+		if err := hw.WriteView(w, http.StatusOK, "index", "again"); err != nil {
+			t.Fatal(err)
+		}
+		areEqual(t, `<script nonce=""></script><p>again</p>`, w.Body.String())
+	}
+}
@@ -0,0 +1,184 @@
+// Package conditional implements conditional requests (RFC 9110 section 13) with
+// ETag and Last-Modified validators, which let clients revalidate cached responses
+// (304 Not Modified) and avoid lost updates (412 Precondition Failed).
+package conditional
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultMaxBufferSize is the size up to which response bodies get buffered to compute an ETag.
+const DefaultMaxBufferSize = 1 << 20
+
+// StrongETag returns a strong entity tag for the given opaque value.
+func StrongETag(value string) string {
+	return `"` + value + `"`
+}
+
+// WeakETag returns a weak entity tag for the given opaque value.
+// Weak tags indicate semantic equivalence rather than byte-for-byte equality.
+func WeakETag(value string) string {
+	return `W/"` + value + `"`
+}
+
+// HashETag returns an entity tag which is derived from the SHA-256 hash of the body.
+func HashETag(body []byte, weak bool) string {
+	sum := sha256.Sum256(body)
+	value := base64.RawURLEncoding.EncodeToString(sum[:16])
+	if weak {
+		return WeakETag(value)
+	}
+	return StrongETag(value)
+}
+
+// entityTag is a parsed entity tag.
+type entityTag struct {
+	weak   bool
+	opaque string
+}
+
+func parseETag(s string) (entityTag, bool) {
+	s = strings.TrimSpace(s)
+	tag := entityTag{}
+	if strings.HasPrefix(s, "W/") {
+		tag.weak = true
+		s = s[2:]
+	}
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' || strings.Contains(s[1:len(s)-1], `"`) {
+		return tag, false
+	}
+	tag.opaque = s[1 : len(s)-1]
+	return tag, true
+}
+
+// parseETagList parses the value of an If-Match or If-None-Match header.
+// It returns nil for the wildcard (*).
+func parseETagList(header string) ([]entityTag, bool) {
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return nil, true
+	}
+	tags := []entityTag{}
+	for len(header) > 0 {
+		header = strings.TrimLeft(header, " \t,")
+		if header == "" {
+			break
+		}
+		start := 0
+		if strings.HasPrefix(header, "W/") {
+			start = 2
+		}
+		if len(header) <= start || header[start] != '"' {
+			return tags, false
+		}
+		end := strings.IndexByte(header[start+1:], '"')
+		if end < 0 {
+			return tags, false
+		}
+		end += start + 2
+		if tag, ok := parseETag(header[:end]); ok {
+			tags = append(tags, tag)
+		}
+		header = header[end:]
+	}
+	return tags, false
+}
+
+// matches compares the current ETag with the tags of a header.
+// Strong comparison requires both tags to be strong.
+func matches(header, current string, strong bool) bool {
+	tags, wildcard := parseETagList(header)
+	if wildcard {
+		return current != ""
+	}
+	cur, ok := parseETag(current)
+	if !ok {
+		return false
+	}
+	for _, tag := range tags {
+		if tag.opaque != cur.opaque {
+			continue
+		}
+		if !strong || (!tag.weak && !cur.weak) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseTime(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	t, err := http.ParseTime(value)
+	return t, err == nil
+}
+
+// Evaluate evaluates the preconditions of a request against the current validators of
+// the target resource in the order of RFC 9110 section 13.2.2. It returns 304 Not Modified,
+// 412 Precondition Failed or 0 if the request should be processed normally.
+//
+// The etag is empty and lastModified is zero if the resource doesn't have the validator.
+func Evaluate(r *http.Request, etag string, lastModified time.Time) int {
+	lastModified = lastModified.Truncate(time.Second)
+	isGetOrHead := r.Method == http.MethodGet || r.Method == http.MethodHead
+
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		if !matches(ifMatch, etag, true) {
+			return http.StatusPreconditionFailed
+		}
+	} else if since, ok := parseTime(r.Header.Get("If-Unmodified-Since")); ok && !lastModified.IsZero() {
+		if lastModified.After(since) {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		if matches(ifNoneMatch, etag, false) {
+			if isGetOrHead {
+				return http.StatusNotModified
+			}
+			return http.StatusPreconditionFailed
+		}
+	} else if since, ok := parseTime(r.Header.Get("If-Modified-Since")); ok && isGetOrHead && !lastModified.IsZero() {
+		if !lastModified.After(since) {
+			return http.StatusNotModified
+		}
+	}
+	return 0
+}
+
+// writeStatus writes a 304 or 412 response without a body.
+func writeStatus(w http.ResponseWriter, status int) {
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	if status == http.StatusPreconditionFailed {
+		h.Del("ETag")
+		h.Del("Last-Modified")
+	}
+	w.WriteHeader(status)
+}
+
+// Check evaluates the preconditions of a request in a handler which knows the current
+// validators of the resource, which is required for state-changing requests (e.g. PUT with If-Match).
+//
+// It writes a 304 or 412 response and returns false if the request must not be processed.
+// Otherwise it sets the ETag and Last-Modified headers and returns true.
+func Check(w http.ResponseWriter, r *http.Request, etag string, lastModified time.Time) bool {
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	if status := Evaluate(r, etag, lastModified); status != 0 {
+		writeStatus(w, status)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,160 @@
+package conditional
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dusted-go/http/v6/middleware/mware"
+)
+
+func areEqual[T comparable](t *testing.T, expected, actual T) {
+	if expected != actual {
+		t.Errorf("Expected: %v, Actual: %v", expected, actual)
+	}
+}
+
+func serve(handler http.Handler, method string, header map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/feed.xml", nil)
+	for name, value := range header {
+		r.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func Test_Middleware_HashedETag(t *testing.T) {
+	handler := Middleware(Options{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		_, _ = io.WriteString(w, "<rss></rss>")
+	}))
+
+	w := serve(handler, http.MethodGet, nil)
+	areEqual(t, http.StatusOK, w.Code)
+	areEqual(t, "<rss></rss>", w.Body.String())
+	etag := w.Header().Get("ETag")
+	areEqual(t, HashETag([]byte("<rss></rss>"), false), etag)
+
+	w = serve(handler, http.MethodGet, map[string]string{"If-None-Match": `"other", W/` + etag})
+	areEqual(t, http.StatusNotModified, w.Code)
+	areEqual(t, "", w.Body.String())
+	areEqual(t, "", w.Header().Get("Content-Type"))
+	areEqual(t, etag, w.Header().Get("ETag"))
+
+	w = serve(handler, http.MethodGet, map[string]string{"If-Match": `"other"`})
+	areEqual(t, http.StatusPreconditionFailed, w.Code)
+}
+
+func Test_Middleware_HandlerValidators(t *testing.T) {
+	modified := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	handler := Middleware(Options{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", WeakETag("v1"))
+		w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+		_, _ = io.WriteString(w, "body")
+	}))
+
+	for _, tc := range []struct {
+		header map[string]string
+		status int
+	}{
+		{nil, 200},
+		{map[string]string{"If-None-Match": `"v1"`}, 304},
+		{map[string]string{"If-None-Match": `"v2"`, "If-Modified-Since": modified.Format(http.TimeFormat)}, 200},
+		{map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)}, 304},
+		{map[string]string{"If-Modified-Since": modified.Add(-time.Hour).Format(http.TimeFormat)}, 200},
+		{map[string]string{"If-Match": `W/"v1"`}, 412},
+		{map[string]string{"If-Match": "*"}, 200},
+		{map[string]string{"If-Unmodified-Since": modified.Add(-time.Hour).Format(http.TimeFormat)}, 412},
+	} {
+		w := serve(handler, http.MethodGet, tc.header)
+		areEqual(t, tc.status, w.Code)
+	}
+}
+
+func Test_Middleware_LargeResponsesAreStreamed(t *testing.T) {
+	body := strings.Repeat("x", 100)
+	handler := Middleware(Options{MaxBufferSize: 10})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, body[:8])
+		_, _ = io.WriteString(w, body[8:])
+	}))
+	w := serve(handler, http.MethodGet, nil)
+	areEqual(t, http.StatusOK, w.Code)
+	areEqual(t, body, w.Body.String())
+	areEqual(t, "", w.Header().Get("ETag"))
+}
+
+func Test_Middleware_HeadRequests(t *testing.T) {
+	body := func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "<rss></rss>")
+	}
+	handler := Middleware(Options{})(http.HandlerFunc(body))
+	etag := HashETag([]byte("<rss></rss>"), false)
+
+	// HEAD responses don't get a hashed ETag:
+	w := serve(handler, http.MethodHead, map[string]string{"If-None-Match": etag})
+	areEqual(t, http.StatusOK, w.Code)
+	areEqual(t, "", w.Header().Get("ETag"))
+
+	// Validators which have been set by the handler are evaluated:
+	handler = Middleware(Options{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		body(w, r)
+	}))
+	w = serve(handler, http.MethodHead, map[string]string{"If-None-Match": etag})
+	areEqual(t, http.StatusNotModified, w.Code)
+}
+
+func Test_Middleware_FlushStreamsWithoutETag(t *testing.T) {
+	handler := Middleware(Options{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "event 1\n")
+		w.(http.Flusher).Flush()
+		_, _ = io.WriteString(w, "event 2\n")
+	}))
+	w := serve(handler, http.MethodGet, nil)
+	areEqual(t, http.StatusOK, w.Code)
+	areEqual(t, true, w.Flushed)
+	areEqual(t, "event 1\nevent 2\n", w.Body.String())
+	areEqual(t, "", w.Header().Get("ETag"))
+}
+
+func Test_Middleware_ReportsFinalStatus(t *testing.T) {
+	var status int
+	outer := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rw := mware.NewResponseWriter(w)
+			next.ServeHTTP(rw, r)
+			status = rw.Status()
+		})
+	}
+	handler := outer(Middleware(Options{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "body")
+	})))
+
+	serve(handler, http.MethodGet, nil)
+	areEqual(t, http.StatusOK, status)
+	serve(handler, http.MethodGet, map[string]string{"If-None-Match": HashETag([]byte("body"), false)})
+	areEqual(t, http.StatusNotModified, status)
+}
+
+func Test_Check(t *testing.T) {
+	for _, tc := range []struct {
+		ifMatch string
+		ok      bool
+		status  int
+	}{
+		{`"v1"`, true, 200},
+		{`"v0", "v1"`, true, 200},
+		{`"v0"`, false, 412},
+		{`W/"v1"`, false, 412},
+	} {
+		r := httptest.NewRequest(http.MethodPut, "/posts/1", nil)
+		r.Header.Set("If-Match", tc.ifMatch)
+		w := httptest.NewRecorder()
+		areEqual(t, tc.ok, Check(w, r, StrongETag("v1"), time.Time{}))
+		areEqual(t, tc.status, w.Code)
+	}
+}
@@ -0,0 +1,178 @@
+package conditional
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/dusted-go/http/v6/middleware/mware"
+)
+
+// Options configures the Middleware.
+type Options struct {
+	// Weak makes the computed ETags weak, which is appropriate if the same content
+	// can be served with a different encoding (e.g. compressed by a proxy).
+	Weak bool
+
+	// MaxBufferSize is the size up to which response bodies get buffered to compute an ETag.
+	// Larger responses are streamed without an ETag. It defaults to DefaultMaxBufferSize.
+	MaxBufferSize int
+
+	// DisableHashing only evaluates validators which have been set by the handler.
+	DisableHashing bool
+}
+
+// Middleware handles conditional GET and HEAD requests.
+//
+// If the handler sets an ETag or Last-Modified header then the preconditions are evaluated
+// as soon as the header gets written. Otherwise the body of a 200 OK response to a GET request
+// gets buffered and hashed to compute an ETag.
+//
+// HEAD responses don't get a hashed ETag, because handlers may omit the body of a HEAD response,
+// which would result in a different ETag than for the GET request. Handlers which want HEAD
+// requests to be conditional must set the validators themselves.
+//
+// State-changing requests pass through unchanged, because their preconditions have to be
+// evaluated against the current state of the resource before it gets modified (see Check).
+func Middleware(opts Options) func(http.Handler) http.Handler {
+	if opts.MaxBufferSize <= 0 {
+		opts.MaxBufferSize = DefaultMaxBufferSize
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodGet && r.Method != http.MethodHead {
+					next.ServeHTTP(w, r)
+					return
+				}
+				cw := &responseWriter{ResponseWriter: mware.NewResponseWriter(w), r: r, opts: opts}
+				next.ServeHTTP(cw, r)
+				cw.finish()
+			},
+		)
+	}
+}
+
+// responseWriter holds back the header until the preconditions have been evaluated.
+// The embedded mware.ResponseWriter is the response which gets sent to the client.
+type responseWriter struct {
+	*mware.ResponseWriter
+
+	r          *http.Request
+	opts       Options
+	buffering  bool
+	discarding bool
+	buf        bytes.Buffer
+}
+
+func (w *responseWriter) pending() bool {
+	return !w.Committed() && !w.buffering
+}
+
+func (w *responseWriter) lastModified() time.Time {
+	t, _ := parseTime(w.Header().Get("Last-Modified"))
+	return t
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if !w.pending() {
+		return
+	}
+	if status < 200 || status >= 300 {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	etag := w.Header().Get("ETag")
+	lastModified := w.lastModified()
+	if etag != "" || !lastModified.IsZero() {
+		if result := Evaluate(w.r, etag, lastModified); result != 0 {
+			w.discarding = true
+			writeStatus(w.ResponseWriter, result)
+			return
+		}
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	if status == http.StatusOK && w.r.Method == http.MethodGet && !w.opts.DisableHashing {
+		w.buffering = true
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.pending() {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.discarding {
+		return len(b), nil
+	}
+	if w.buffering {
+		if w.buf.Len()+len(b) <= w.opts.MaxBufferSize {
+			// nolint: wrapcheck // Writing to a bytes.Buffer never fails
+			return w.buf.Write(b)
+		}
+		if err := w.stopBuffering(); err != nil {
+			return 0, err
+		}
+	}
+	// nolint: wrapcheck // Must behave like the wrapped writer
+	return w.ResponseWriter.Write(b)
+}
+
+// stopBuffering sends the buffered 200 OK response without an ETag.
+func (w *responseWriter) stopBuffering() error {
+	w.buffering = false
+	if w.buf.Len() == 0 {
+		w.ResponseWriter.WriteHeader(http.StatusOK)
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(w.buf.Bytes())
+	// nolint: wrapcheck // Must behave like the wrapped writer
+	return err
+}
+
+// finish computes the ETag of a buffered response and writes the response.
+func (w *responseWriter) finish() {
+	if !w.buffering {
+		return
+	}
+	etag := HashETag(w.buf.Bytes(), w.opts.Weak)
+	w.Header().Set("ETag", etag)
+	if result := Evaluate(w.r, etag, time.Time{}); result != 0 {
+		w.buffering = false
+		w.discarding = true
+		writeStatus(w.ResponseWriter, result)
+		return
+	}
+	_ = w.stopBuffering()
+}
+
+// Flush implements http.Flusher. Flushing a buffered response streams it without an ETag.
+func (w *responseWriter) Flush() {
+	if w.pending() {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.buffering {
+		_ = w.stopBuffering()
+	}
+	if !w.discarding {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker if the wrapped writer supports it (e.g. for WebSocket upgrades).
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := w.ResponseWriter.Hijack()
+	if err != nil {
+		// nolint: wrapcheck // The error has been wrapped already
+		return nil, nil, err
+	}
+	w.buffering = false
+	w.discarding = true
+	return conn, rw, nil
+}
@@ -0,0 +1,62 @@
+package headers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AltService is an alternative service (RFC 7838) which serves the same origin
+// with another protocol or on another endpoint, e.g. a HTTP/3 server on UDP port 443:
+//
+//	headers.AltService{Protocol: "h3", Port: 443, MaxAge: 24 * time.Hour}
+type AltService struct {
+	// Protocol is the ALPN protocol ID (e.g. h3 or h2).
+	Protocol string
+
+	// Host is empty if the alternative service runs on the same host.
+	Host string
+	Port int
+
+	// MaxAge is how long clients may cache the advertisement.
+	// Clients use their default of 24 hours if it's zero.
+	MaxAge time.Duration
+}
+
+func (a AltService) String() string {
+	value := fmt.Sprintf("%s=%q", a.Protocol, a.Host+":"+strconv.Itoa(a.Port))
+	if a.MaxAge > 0 {
+		value += fmt.Sprintf("; ma=%d", int64(a.MaxAge/time.Second))
+	}
+	return value
+}
+
+// AltSvc is a middleware which advertises alternative services with the Alt-Svc header,
+// which lets clients upgrade to HTTP/3 after their first request.
+//
+// The header is not sent on HTTP/3 responses, because those clients use HTTP/3 already.
+// Calling AltSvc without any services sends Alt-Svc: clear, which makes
+// clients forget all previously advertised alternatives.
+func AltSvc(services ...AltService) func(http.Handler) http.Handler {
+	value := "clear"
+	if len(services) > 0 {
+		values := make([]string, 0, len(services))
+		for _, s := range services {
+			values = append(values, s.String())
+		}
+		value = strings.Join(values, ", ")
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if r.ProtoMajor < 3 {
+					w.Header().Set("Alt-Svc", value)
+				}
+				next.ServeHTTP(w, r)
+			},
+		)
+	}
+}
@@ -0,0 +1,156 @@
+package headers
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dusted-go/http/v6/middleware/mware"
+)
+
+// CacheRule assigns caching headers to all responses which match
+// one of its path patterns and one of its content types.
+//
+// Paths are matched with path.Match, except for patterns ending with a slash,
+// which match all paths with that prefix. Content types are matched by prefix
+// (e.g. "image/" matches all images). An empty list matches everything.
+type CacheRule struct {
+	Paths        []string
+	ContentTypes []string
+	CacheControl string
+	Vary         []string
+}
+
+// ImmutableAssets returns a rule for content hashed assets which never change.
+func ImmutableAssets(paths ...string) CacheRule {
+	return CacheRule{
+		Paths:        paths,
+		CacheControl: "public, max-age=31536000, immutable",
+		Vary:         []string{"Accept-Encoding"},
+	}
+}
+
+// HTMLPages returns a rule which makes clients revalidate HTML pages on every request.
+func HTMLPages() CacheRule {
+	return CacheRule{
+		ContentTypes: []string{"text/html"},
+		CacheControl: "no-cache",
+		Vary:         []string{"Accept-Encoding"},
+	}
+}
+
+// Feeds returns a rule which lets clients and shared caches keep RSS and Atom feeds for maxAge.
+func Feeds(maxAge time.Duration) CacheRule {
+	return CacheRule{
+		ContentTypes: []string{
+			"application/rss+xml",
+			"application/atom+xml",
+		},
+		CacheControl: fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())),
+		Vary:         []string{"Accept-Encoding"},
+	}
+}
+
+// PrivateResponses returns a rule which prevents any caching of the matching paths.
+func PrivateResponses(paths ...string) CacheRule {
+	return CacheRule{
+		Paths:        paths,
+		CacheControl: "private, no-store",
+	}
+}
+
+func (c CacheRule) matchesPath(p string) bool {
+	if len(c.Paths) == 0 {
+		return true
+	}
+	for _, pattern := range c.Paths {
+		if strings.HasSuffix(pattern, "/") {
+			if strings.HasPrefix(p, pattern) {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c CacheRule) matchesContentType(contentType string) bool {
+	if len(c.ContentTypes) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range c.ContentTypes {
+		if strings.HasPrefix(mediaType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// maxAge returns the value of the max-age directive or -1 if it's not set.
+func maxAge(cacheControl string) int {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.TrimSpace(directive)
+		if strings.HasPrefix(directive, "max-age=") {
+			seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+			if err == nil {
+				return seconds
+			}
+		}
+	}
+	return -1
+}
+
+func (c CacheRule) apply(h http.Header, now time.Time) {
+	if h.Get("Cache-Control") == "" {
+		h.Set("Cache-Control", c.CacheControl)
+		if seconds := maxAge(c.CacheControl); seconds >= 0 && h.Get("Expires") == "" {
+			h.Set("Expires", now.Add(time.Duration(seconds)*time.Second).UTC().Format(http.TimeFormat))
+		}
+	}
+	if len(c.Vary) > 0 && h.Get("Vary") == "" {
+		h.Set("Vary", strings.Join(c.Vary, ", "))
+	}
+}
+
+// CacheControl is a middleware which sets the Cache-Control, Expires and Vary headers
+// of a response according to the first matching rule.
+//
+// Rules are evaluated when the response header gets written, so that the content type
+// of the response can be taken into account. If a handler doesn't set the Content-Type
+// then it gets detected from the first write, the same way as net/http does it.
+// Headers which have been set by a handler explicitly are never overridden.
+// Error responses are left untouched.
+func CacheControl(rules ...CacheRule) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				rw := mware.NewResponseWriter(w)
+				rw.BeforeWriteHeader(func(status int) {
+					if status >= 400 {
+						return
+					}
+					h := rw.Header()
+					contentType := h.Get("Content-Type")
+					for _, rule := range rules {
+						if rule.matchesPath(r.URL.Path) && rule.matchesContentType(contentType) {
+							rule.apply(h, time.Now())
+							return
+						}
+					}
+				})
+				next.ServeHTTP(rw, r)
+			},
+		)
+	}
+}
@@ -0,0 +1,265 @@
+package headers
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CSPReport is a single Content-Security-Policy violation report.
+type CSPReport struct {
+	DocumentURI        string
+	Referrer           string
+	BlockedURI         string
+	EffectiveDirective string
+	OriginalPolicy     string
+	Disposition        string
+	SourceFile         string
+	Sample             string
+	LineNumber         int
+	ColumnNumber       int
+	StatusCode         int
+	UserAgent          string
+}
+
+func (c *CSPReport) key() string {
+	return c.Disposition + "|" +
+		c.DocumentURI + "|" +
+		c.BlockedURI + "|" +
+		c.EffectiveDirective + "|" +
+		c.SourceFile + "|" +
+		strconv.Itoa(c.LineNumber) + ":" + strconv.Itoa(c.ColumnNumber)
+}
+
+func (c *CSPReport) valid() bool {
+	return c.DocumentURI != "" && c.EffectiveDirective != ""
+}
+
+// legacyReport is the format which is sent to a report-uri endpoint.
+type legacyReport struct {
+	Report struct {
+		DocumentURI        string `json:"document-uri"`
+		Referrer           string `json:"referrer"`
+		BlockedURI         string `json:"blocked-uri"`
+		ViolatedDirective  string `json:"violated-directive"`
+		EffectiveDirective string `json:"effective-directive"`
+		OriginalPolicy     string `json:"original-policy"`
+		Disposition        string `json:"disposition"`
+		SourceFile         string `json:"source-file"`
+		ScriptSample       string `json:"script-sample"`
+		LineNumber         int    `json:"line-number"`
+		ColumnNumber       int    `json:"column-number"`
+		StatusCode         int    `json:"status-code"`
+	} `json:"csp-report"`
+}
+
+// reportingAPIReport is the format which is sent to a report-to endpoint.
+type reportingAPIReport struct {
+	Type      string `json:"type"`
+	URL       string `json:"url"`
+	UserAgent string `json:"user_agent"`
+	Body      struct {
+		DocumentURL        string `json:"documentURL"`
+		Referrer           string `json:"referrer"`
+		BlockedURL         string `json:"blockedURL"`
+		EffectiveDirective string `json:"effectiveDirective"`
+		OriginalPolicy     string `json:"originalPolicy"`
+		Disposition        string `json:"disposition"`
+		SourceFile         string `json:"sourceFile"`
+		Sample             string `json:"sample"`
+		LineNumber         int    `json:"lineNumber"`
+		ColumnNumber       int    `json:"columnNumber"`
+		StatusCode         int    `json:"statusCode"`
+	} `json:"body"`
+}
+
+func parseLegacyReport(data []byte, userAgent string) ([]*CSPReport, error) {
+	legacy := legacyReport{}
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return nil, fmt.Errorf("error decoding CSP report: %w", err)
+	}
+	r := legacy.Report
+	report := &CSPReport{
+		DocumentURI:        r.DocumentURI,
+		Referrer:           r.Referrer,
+		BlockedURI:         r.BlockedURI,
+		EffectiveDirective: r.EffectiveDirective,
+		OriginalPolicy:     r.OriginalPolicy,
+		Disposition:        r.Disposition,
+		SourceFile:         r.SourceFile,
+		Sample:             r.ScriptSample,
+		LineNumber:         r.LineNumber,
+		ColumnNumber:       r.ColumnNumber,
+		StatusCode:         r.StatusCode,
+		UserAgent:          userAgent,
+	}
+	// Older browsers only send the violated directive:
+	if report.EffectiveDirective == "" {
+		report.EffectiveDirective = r.ViolatedDirective
+	}
+	return []*CSPReport{report}, nil
+}
+
+func parseReportingAPIReports(data []byte) ([]*CSPReport, error) {
+	reports := []reportingAPIReport{}
+	if err := json.Unmarshal(data, &reports); err != nil {
+		return nil, fmt.Errorf("error decoding reports: %w", err)
+	}
+	cspReports := make([]*CSPReport, 0, len(reports))
+	for _, r := range reports {
+		if r.Type != "csp-violation" {
+			continue
+		}
+		documentURL := r.Body.DocumentURL
+		if documentURL == "" {
+			documentURL = r.URL
+		}
+		cspReports = append(cspReports, &CSPReport{
+			DocumentURI:        documentURL,
+			Referrer:           r.Body.Referrer,
+			BlockedURI:         r.Body.BlockedURL,
+			EffectiveDirective: r.Body.EffectiveDirective,
+			OriginalPolicy:     r.Body.OriginalPolicy,
+			Disposition:        r.Body.Disposition,
+			SourceFile:         r.Body.SourceFile,
+			Sample:             r.Body.Sample,
+			LineNumber:         r.Body.LineNumber,
+			ColumnNumber:       r.Body.ColumnNumber,
+			StatusCode:         r.Body.StatusCode,
+			UserAgent:          r.UserAgent,
+		})
+	}
+	return cspReports, nil
+}
+
+// ParseCSPReports parses the body of a CSP violation report request.
+// Both the report-uri (application/csp-report) and
+// the Reporting API (application/reports+json) formats are supported.
+func ParseCSPReports(contentType string, data []byte, userAgent string) ([]*CSPReport, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing content type '%s': %w", contentType, err)
+	}
+	switch mediaType {
+	case "application/csp-report", "application/json":
+		return parseLegacyReport(data, userAgent)
+	case "application/reports+json":
+		return parseReportingAPIReports(data)
+	default:
+		return nil, fmt.Errorf("unsupported content type for CSP reports: %s", mediaType)
+	}
+}
+
+// maxCachedReports limits the memory used for deduplication.
+// The reports which have been seen first get evicted first.
+const maxCachedReports = 1000
+
+type cachedReport struct {
+	key    string
+	seenAt time.Time
+}
+
+// reportCache remembers the reports which have been seen within the window.
+// Entries are ordered by the time they have been seen first, the most recent first.
+// Duplicates don't move an entry, so the window starts with the first sighting of a report.
+type reportCache struct {
+	mutex    sync.Mutex
+	window   time.Duration
+	capacity int
+	entries  *list.List
+	seen     map[string]*list.Element
+}
+
+func newReportCache(window time.Duration, capacity int) *reportCache {
+	return &reportCache{
+		window:   window,
+		capacity: capacity,
+		entries:  list.New(),
+		seen:     map[string]*list.Element{},
+	}
+}
+
+func (c *reportCache) remove(e *list.Element) {
+	c.entries.Remove(e)
+	delete(c.seen, e.Value.(*cachedReport).key)
+}
+
+// isDuplicate returns true if the same report has been seen within the window.
+func (c *reportCache) isDuplicate(key string, now time.Time) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// Expired entries are at the back:
+	for e := c.entries.Back(); e != nil; e = c.entries.Back() {
+		if now.Sub(e.Value.(*cachedReport).seenAt) < c.window {
+			break
+		}
+		c.remove(e)
+	}
+
+	if _, ok := c.seen[key]; ok {
+		return true
+	}
+	c.seen[key] = c.entries.PushFront(&cachedReport{key: key, seenAt: now})
+	if c.entries.Len() > c.capacity {
+		c.remove(c.entries.Back())
+	}
+	return false
+}
+
+// CSPReportHandler returns a handler which collects CSP violation reports.
+//
+// Reports which are invalid or which have been received already within the dedupWindow get dropped.
+// All remaining reports are passed on to the handle function.
+// Request bodies which are larger than maxBodySize get rejected.
+func CSPReportHandler(
+	maxBodySize int64,
+	dedupWindow time.Duration,
+	handle func(reports []*CSPReport),
+) http.HandlerFunc {
+	cache := newReportCache(dedupWindow, maxCachedReports)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err != nil {
+			// MaxBytesReader returns an unexported error type before Go 1.19:
+			if strings.Contains(err.Error(), "request body too large") {
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				return
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		reports, err := ParseCSPReports(r.Header.Get("Content-Type"), data, r.UserAgent())
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		now := time.Now()
+		accepted := make([]*CSPReport, 0, len(reports))
+		for _, report := range reports {
+			if !report.valid() || cache.isDuplicate(report.key(), now) {
+				continue
+			}
+			accepted = append(accepted, report)
+		}
+		if len(accepted) > 0 {
+			handle(accepted)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
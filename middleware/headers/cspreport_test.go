@@ -0,0 +1,146 @@
+package headers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func areEqual[T comparable](t *testing.T, expected, actual T) {
+	if expected != actual {
+		t.Errorf("Expected: %v, Actual: %v", expected, actual)
+	}
+}
+
+const legacyReportBody = `{
+  "csp-report": {
+    "document-uri": "https://example.org/page",
+    "referrer": "",
+    "blocked-uri": "https://evil.example.com/script.js",
+    "violated-directive": "script-src",
+    "original-policy": "script-src 'self'; report-uri /csp",
+    "disposition": "enforce",
+    "line-number": 12
+  }
+}`
+
+const reportingAPIBody = `[
+  {
+    "type": "csp-violation",
+    "age": 10,
+    "url": "https://example.org/page",
+    "user_agent": "Test/1.0",
+    "body": {
+      "documentURL": "https://example.org/page",
+      "blockedURL": "inline",
+      "effectiveDirective": "style-src-elem",
+      "originalPolicy": "style-src 'self'; report-to csp",
+      "disposition": "report",
+      "lineNumber": 3,
+      "columnNumber": 7
+    }
+  },
+  {
+    "type": "deprecation",
+    "url": "https://example.org/page",
+    "body": {}
+  }
+]`
+
+func Test_ParseCSPReports_Legacy(t *testing.T) {
+	reports, err := ParseCSPReports("application/csp-report", []byte(legacyReportBody), "Test/1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	areEqual(t, 1, len(reports))
+	areEqual(t, "https://example.org/page", reports[0].DocumentURI)
+	areEqual(t, "https://evil.example.com/script.js", reports[0].BlockedURI)
+	areEqual(t, "script-src", reports[0].EffectiveDirective)
+	areEqual(t, 12, reports[0].LineNumber)
+	areEqual(t, "Test/1.0", reports[0].UserAgent)
+}
+
+func Test_ParseCSPReports_ReportingAPI(t *testing.T) {
+	reports, err := ParseCSPReports("application/reports+json", []byte(reportingAPIBody), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	areEqual(t, 1, len(reports))
+	areEqual(t, "inline", reports[0].BlockedURI)
+	areEqual(t, "style-src-elem", reports[0].EffectiveDirective)
+	areEqual(t, "report", reports[0].Disposition)
+	areEqual(t, 7, reports[0].ColumnNumber)
+	areEqual(t, "Test/1.0", reports[0].UserAgent)
+}
+
+func Test_ParseCSPReports_UnsupportedContentType(t *testing.T) {
+	_, err := ParseCSPReports("text/plain", []byte(legacyReportBody), "")
+	if err == nil {
+		t.Error("Expected an error for an unsupported content type")
+	}
+}
+
+func Test_CSPReportHandler_Deduplicates(t *testing.T) {
+	received := 0
+	handler := CSPReportHandler(
+		1024*10,
+		time.Minute,
+		func(reports []*CSPReport) { received += len(reports) })
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/csp", strings.NewReader(legacyReportBody))
+		req.Header.Set("Content-Type", "application/csp-report")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		areEqual(t, http.StatusNoContent, rec.Code)
+	}
+	areEqual(t, 1, received)
+}
+
+func Test_ReportCache_EvictsFirstSeen(t *testing.T) {
+	cache := newReportCache(time.Minute, 2)
+	now := time.Now()
+	areEqual(t, false, cache.isDuplicate("a", now))
+	areEqual(t, false, cache.isDuplicate("b", now))
+	areEqual(t, true, cache.isDuplicate("a", now))
+	areEqual(t, false, cache.isDuplicate("c", now))
+	areEqual(t, 2, cache.entries.Len())
+
+	// The report which has been seen first has been evicted, even though it was seen again:
+	areEqual(t, false, cache.isDuplicate("a", now))
+	areEqual(t, true, cache.isDuplicate("c", now))
+
+	// Duplicates don't extend the window:
+	areEqual(t, true, cache.isDuplicate("c", now.Add(59*time.Second)))
+
+	// Expired reports are not duplicates anymore:
+	later := now.Add(time.Minute)
+	areEqual(t, false, cache.isDuplicate("c", later))
+	areEqual(t, 1, cache.entries.Len())
+	areEqual(t, 1, len(cache.seen))
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, io.ErrUnexpectedEOF
+}
+
+func Test_CSPReportHandler_BodyErrors(t *testing.T) {
+	handler := CSPReportHandler(16, time.Minute, func([]*CSPReport) {})
+
+	req := httptest.NewRequest(http.MethodPost, "/csp", strings.NewReader(legacyReportBody))
+	req.Header.Set("Content-Type", "application/csp-report")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	areEqual(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/csp", failingReader{})
+	req.Header.Set("Content-Type", "application/csp-report")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	areEqual(t, http.StatusBadRequest, rec.Code)
+}
@@ -1,25 +1,325 @@
 package headers
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
 	"fmt"
 	"net/http"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
 )
 
-// Security will set HTTP security headers.
+// Nonce is a placeholder which can be used as a source in any CSP directive.
+// It gets replaced with a unique 'nonce-...' source on every request.
+const Nonce = "'nonce'"
+
+type nonceKey struct{}
+
+// HSTS configures the Strict-Transport-Security header.
+type HSTS struct {
+	MaxAge            int
+	IncludeSubDomains bool
+	Preload           bool
+}
+
+func (h *HSTS) String() string {
+	value := fmt.Sprintf("max-age=%d", h.MaxAge)
+	if h.IncludeSubDomains {
+		value += "; includeSubDomains"
+	}
+	if h.Preload {
+		value += "; preload"
+	}
+	return value
+}
+
+// CSP configures the Content-Security-Policy header.
+//
+// Directives maps a directive name (e.g. script-src) to its sources.
+// Use the Nonce placeholder as a source to allow inline scripts or styles
+// which carry the per request nonce (see GetNonce).
 //
-// It is the same as calling response.SecurityHeaders with the given hstsMaxAge, except that the middleware will apply those headers to all responses automatically.
+// Violations get reported when the report-uri and/or report-to directives are set
+// (see CSPReportHandler).
+type CSP struct {
+	Directives map[string][]string
+}
+
+func (c *CSP) usesNonce() bool {
+	for _, sources := range c.Directives {
+		for _, s := range sources {
+			if s == Nonce {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *CSP) render(nonce string) string {
+	names := make([]string, 0, len(c.Directives))
+	for name := range c.Directives {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	directives := make([]string, 0, len(names))
+	for _, name := range names {
+		directive := name
+		for _, s := range c.Directives[name] {
+			if s == Nonce {
+				s = "'nonce-" + nonce + "'"
+			}
+			directive += " " + s
+		}
+		directives = append(directives, directive)
+	}
+	return strings.Join(directives, "; ")
+}
+
+// Policy describes the set of security headers which get applied to a response.
 //
-// For more information check the response.SecurityHeaders function.
+// Empty fields are not being set, which means that a header
+// can be dropped from a policy by leaving its field empty.
+type Policy struct {
+	HSTS *HSTS
+	CSP  *CSP
+
+	// CSPReportOnly is sent as Content-Security-Policy-Report-Only,
+	// which reports violations without blocking anything.
+	// It can be set alongside CSP to stage a stricter policy.
+	CSPReportOnly *CSP
+
+	// ReportingEndpoints maps an endpoint name (as used by the report-to directive)
+	// to a URL and is sent as the Reporting-Endpoints header.
+	ReportingEndpoints map[string]string
+
+	// PermissionsPolicy maps a feature (e.g. camera) to its allowlist.
+	// The values self and * are written as is, everything else is quoted as an origin.
+	// An empty allowlist disables the feature entirely.
+	PermissionsPolicy map[string][]string
+
+	CrossOriginOpenerPolicy   string
+	CrossOriginEmbedderPolicy string
+	CrossOriginResourcePolicy string
+
+	ContentTypeOptions string
+	FrameOptions       string
+	ReferrerPolicy     string
+}
+
+// DefaultPolicy returns the policy which is applied by the Security middleware.
+func DefaultPolicy(hstsMaxAge int) *Policy {
+	return &Policy{
+		HSTS: &HSTS{
+			MaxAge:            hstsMaxAge,
+			IncludeSubDomains: true,
+		},
+		ContentTypeOptions: "nosniff",
+		FrameOptions:       "SAMEORIGIN",
+		ReferrerPolicy:     "strict-origin-when-cross-origin",
+	}
+}
+
+func permissionsPolicy(features map[string][]string) string {
+	names := make([]string, 0, len(features))
+	for name := range features {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := make([]string, 0, len(names))
+	for _, name := range names {
+		allowlist := make([]string, 0, len(features[name]))
+		for _, origin := range features[name] {
+			if origin == "self" || origin == "*" {
+				allowlist = append(allowlist, origin)
+			} else {
+				allowlist = append(allowlist, `"`+origin+`"`)
+			}
+		}
+		if len(allowlist) == 1 && allowlist[0] == "*" {
+			values = append(values, name+"=*")
+			continue
+		}
+		values = append(values, name+"=("+strings.Join(allowlist, " ")+")")
+	}
+	return strings.Join(values, ", ")
+}
+
+func reportingEndpoints(endpoints map[string]string) string {
+	names := make([]string, 0, len(endpoints))
+	for name := range endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := make([]string, 0, len(names))
+	for _, name := range names {
+		values = append(values, name+`="`+endpoints[name]+`"`)
+	}
+	return strings.Join(values, ", ")
+}
+
+// staticHeaders returns all headers which don't change between requests.
+func (p *Policy) staticHeaders() map[string]string {
+	h := map[string]string{}
+	if p.HSTS != nil {
+		h["Strict-Transport-Security"] = p.HSTS.String()
+	}
+	if len(p.ReportingEndpoints) > 0 {
+		h["Reporting-Endpoints"] = reportingEndpoints(p.ReportingEndpoints)
+	}
+	if len(p.PermissionsPolicy) > 0 {
+		h["Permissions-Policy"] = permissionsPolicy(p.PermissionsPolicy)
+	}
+	if p.CrossOriginOpenerPolicy != "" {
+		h["Cross-Origin-Opener-Policy"] = p.CrossOriginOpenerPolicy
+	}
+	if p.CrossOriginEmbedderPolicy != "" {
+		h["Cross-Origin-Embedder-Policy"] = p.CrossOriginEmbedderPolicy
+	}
+	if p.CrossOriginResourcePolicy != "" {
+		h["Cross-Origin-Resource-Policy"] = p.CrossOriginResourcePolicy
+	}
+	if p.ContentTypeOptions != "" {
+		h["X-Content-Type-Options"] = p.ContentTypeOptions
+	}
+	if p.FrameOptions != "" {
+		h["X-Frame-Options"] = p.FrameOptions
+	}
+	if p.ReferrerPolicy != "" {
+		h["Referrer-Policy"] = p.ReferrerPolicy
+	}
+	return h
+}
+
+func newNonce() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Errorf("error generating CSP nonce: %w", err))
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// GetNonce returns the CSP nonce of the current request.
+// It returns an empty string if the request's policy doesn't make use of a nonce.
+func GetNonce(ctx context.Context) string {
+	if nonce, ok := ctx.Value(nonceKey{}).(string); ok {
+		return nonce
+	}
+	return ""
+}
+
+// SecurityPolicy will set all HTTP security headers of the given policy.
+//
+// If the CSP makes use of the Nonce placeholder then a new nonce gets
+// generated for every request and stored in the request context.
+//
+// Applying another SecurityPolicy further down the chain (e.g. for a single route)
+// replaces the headers of the previous one.
+func SecurityPolicy(p *Policy) func(http.Handler) http.Handler {
+	static := p.staticHeaders()
+	policies := map[string]*CSP{}
+	if p.CSP != nil {
+		policies["Content-Security-Policy"] = p.CSP
+	}
+	if p.CSPReportOnly != nil {
+		policies["Content-Security-Policy-Report-Only"] = p.CSPReportOnly
+	}
+	usesNonce := false
+	for name, csp := range policies {
+		if csp.usesNonce() {
+			usesNonce = true
+			continue
+		}
+		static[name] = csp.render("")
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				for name, value := range static {
+					w.Header().Set(name, value)
+				}
+				if usesNonce {
+					nonce := newNonce()
+					for name, csp := range policies {
+						if csp.usesNonce() {
+							w.Header().Set(name, csp.render(nonce))
+						}
+					}
+					r = r.WithContext(context.WithValue(r.Context(), nonceKey{}, nonce))
+				}
+				next.ServeHTTP(w, r)
+			},
+		)
+	}
+}
+
+// Security will set HTTP security headers.
+//
+// It is the same as calling SecurityPolicy with DefaultPolicy(hstsMaxAge).
 func Security(hstsMaxAge int) func(http.Handler) http.Handler {
+	return SecurityPolicy(DefaultPolicy(hstsMaxAge))
+}
+
+// connectionSpecificHeaders must not be sent in HTTP/2 and HTTP/3 responses.
+var connectionSpecificHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+func isConnectionSpecific(name string) bool {
+	for _, h := range connectionSpecificHeaders {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Override is a middleware which sets the given headers on a single route,
+// replacing any values which have been set by a previous middleware.
+//
+// Connection-specific headers (e.g. Connection or Upgrade) are only set on HTTP/1.x responses.
+// Override panics if a name is not a valid header name, which includes HTTP/2 pseudo-headers (e.g. :status).
+func Override(headers map[string]string) func(http.Handler) http.Handler {
+	for name := range headers {
+		if !httpguts.ValidHeaderFieldName(name) {
+			panic(fmt.Sprintf("headers: invalid header name %q", name))
+		}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				for name, value := range headers {
+					if r.ProtoMajor >= 2 && isConnectionSpecific(name) {
+						continue
+					}
+					w.Header().Set(name, value)
+				}
+				next.ServeHTTP(w, r)
+			},
+		)
+	}
+}
+
+// Drop is a middleware which removes the given headers on a single route
+// after they have been set by a previous middleware.
+func Drop(names ...string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(
 			func(w http.ResponseWriter, r *http.Request) {
-				w.Header().Set(
-					"Strict-Transport-Security",
-					fmt.Sprintf("max-age=%d; includeSubDomains", hstsMaxAge))
-				w.Header().Set("X-Content-Type-Options", "nosniff")
-				w.Header().Set("X-Frame-Options", "SAMEORIGIN")
-				w.Header().Set("Referrer-Policy", "strict-origin-when-cross-origin")
+				for _, name := range names {
+					w.Header().Del(name)
+				}
 				next.ServeHTTP(w, r)
 			},
 		)
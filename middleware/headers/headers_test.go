@@ -0,0 +1,107 @@
+package headers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_Override_SkipsConnectionSpecificHeadersOnHTTP2(t *testing.T) {
+	handler := Override(map[string]string{
+		"Connection": "close",
+		"X-Robots":   "noindex",
+	})(http.NotFoundHandler())
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Proto, r.ProtoMajor, r.ProtoMinor = "HTTP/2.0", 2, 0
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	areEqual(t, "", w.Header().Get("Connection"))
+	areEqual(t, "noindex", w.Header().Get("X-Robots"))
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	areEqual(t, "close", w.Header().Get("Connection"))
+}
+
+func Test_Override_PanicsOnPseudoHeaders(t *testing.T) {
+	defer func() {
+		areEqual(t, true, recover() != nil)
+	}()
+	Override(map[string]string{":status": "200"})
+}
+
+func Test_AltSvc(t *testing.T) {
+	handler := AltSvc(
+		AltService{Protocol: "h3", Port: 443, MaxAge: time.Hour},
+		AltService{Protocol: "h2", Host: "alt.example.org", Port: 8443},
+	)(http.NotFoundHandler())
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	areEqual(t, `h3=":443"; ma=3600, h2="alt.example.org:8443"`, w.Header().Get("Alt-Svc"))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Proto, r.ProtoMajor, r.ProtoMinor = "HTTP/3.0", 3, 0
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	areEqual(t, "", w.Header().Get("Alt-Svc"))
+}
+
+func Test_CacheControl(t *testing.T) {
+	middleware := CacheControl(
+		PrivateResponses("/account/"),
+		ImmutableAssets("/assets/*.css"),
+		HTMLPages(),
+		Feeds(time.Hour),
+	)
+
+	testCases := []struct {
+		name         string
+		target       string
+		contentType  string
+		cacheControl string
+		status       int
+		body         string
+		expected     string
+		vary         string
+		expires      bool
+	}{
+		{"private prefix", "/account/settings", "text/html", "", 200, "", "private, no-store", "", false},
+		{"immutable asset", "/assets/app.css", "text/css", "", 200, "", "public, max-age=31536000, immutable", "Accept-Encoding", true},
+		{"asset in sub directory", "/assets/css/app.css", "text/css", "", 200, "", "", "", false},
+		{"html page", "/about", "text/html; charset=utf-8", "", 200, "", "no-cache", "Accept-Encoding", false},
+		{"sniffed html page", "/about", "", "", 200, "<!DOCTYPE html><html></html>", "no-cache", "Accept-Encoding", false},
+		{"sniffed text", "/about", "", "", 200, "hello", "", "", false},
+		{"feed", "/feed", "application/atom+xml", "", 200, "", "public, max-age=3600", "Accept-Encoding", true},
+		{"explicit header", "/about", "text/html", "max-age=60", 200, "", "max-age=60", "Accept-Encoding", false},
+		{"error response", "/about", "text/html", "", 404, "", "", "", false},
+		{"no matching rule", "/api", "application/json", "", 200, "", "", "", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.contentType != "" {
+					w.Header().Set("Content-Type", tc.contentType)
+				}
+				if tc.cacheControl != "" {
+					w.Header().Set("Cache-Control", tc.cacheControl)
+				}
+				if tc.body != "" {
+					_, _ = io.WriteString(w, tc.body)
+					return
+				}
+				w.WriteHeader(tc.status)
+			}))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.target, nil))
+
+			areEqual(t, tc.status, w.Code)
+			areEqual(t, tc.expected, w.Header().Get("Cache-Control"))
+			areEqual(t, tc.vary, w.Header().Get("Vary"))
+			areEqual(t, tc.expires, w.Header().Get("Expires") != "")
+		})
+	}
+}
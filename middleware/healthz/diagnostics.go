@@ -0,0 +1,306 @@
+package healthz
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Module describes a Go module which has been compiled into the binary.
+type Module struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	Sum     string `json:"sum,omitempty"`
+}
+
+// BuildInfo contains the build information of the running binary.
+type BuildInfo struct {
+	GoVersion string            `json:"goVersion"`
+	Path      string            `json:"path"`
+	Main      Module            `json:"main"`
+	Settings  map[string]string `json:"settings"`
+	Deps      []Module          `json:"deps"`
+}
+
+// ProcessInfo contains information about the running process.
+type ProcessInfo struct {
+	PID           int       `json:"pid"`
+	StartedAt     time.Time `json:"startedAt"`
+	UptimeSeconds float64   `json:"uptimeSeconds"`
+	Goroutines    int       `json:"goroutines"`
+	NumCPU        int       `json:"numCPU"`
+	GOMAXPROCS    int       `json:"gomaxprocs"`
+	OpenFDs       int       `json:"openFDs"`
+}
+
+// MemoryInfo contains a subset of runtime.MemStats.
+type MemoryInfo struct {
+	Alloc       uint64 `json:"alloc"`
+	TotalAlloc  uint64 `json:"totalAlloc"`
+	Sys         uint64 `json:"sys"`
+	HeapAlloc   uint64 `json:"heapAlloc"`
+	HeapInuse   uint64 `json:"heapInuse"`
+	HeapObjects uint64 `json:"heapObjects"`
+	StackInuse  uint64 `json:"stackInuse"`
+}
+
+// GCInfo contains garbage collector statistics.
+type GCInfo struct {
+	NumGC          uint32    `json:"numGC"`
+	LastGC         time.Time `json:"lastGC"`
+	PauseTotalMS   float64   `json:"pauseTotalMs"`
+	RecentPausesMS []float64 `json:"recentPausesMs"`
+}
+
+// DiagnosticsInfo is the response of the diagnostics endpoint.
+type DiagnosticsInfo struct {
+	Build   *BuildInfo             `json:"build,omitempty"`
+	Process ProcessInfo            `json:"process"`
+	Memory  MemoryInfo             `json:"memory"`
+	GC      GCInfo                 `json:"gc"`
+	Config  map[string]interface{} `json:"config,omitempty"`
+}
+
+// Diagnostics exposes runtime information about the running process.
+//
+// Access must be granted explicitly, either by whitelisting
+// IP addresses or by setting a bearer token.
+type Diagnostics struct {
+	path        string
+	config      map[string]interface{}
+	startedAt   time.Time
+	whitelisted []net.IP
+	token       string
+}
+
+// NewDiagnostics creates a diagnostics endpoint for the given path.
+//
+// The config is included in the response as is and should describe
+// the middleware configuration of the service. It must not contain secrets.
+func NewDiagnostics(path string, config map[string]interface{}) *Diagnostics {
+	return &Diagnostics{
+		path:      path,
+		config:    config,
+		startedAt: time.Now(),
+	}
+}
+
+// AllowIPs grants access to requests from the given IP addresses.
+func (d *Diagnostics) AllowIPs(ips ...net.IP) *Diagnostics {
+	d.whitelisted = append(d.whitelisted, ips...)
+	return d
+}
+
+// RequireToken grants access to requests with an "Authorization: Bearer <token>" header.
+func (d *Diagnostics) RequireToken(token string) *Diagnostics {
+	d.token = token
+	return d
+}
+
+func (d *Diagnostics) isAuthorized(r *http.Request) bool {
+	if d.token != "" {
+		auth := r.Header.Get("Authorization")
+		if strings.HasPrefix(auth, "Bearer ") &&
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(d.token)) == 1 {
+			return true
+		}
+	}
+	if len(d.whitelisted) > 0 {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		requestIP := net.ParseIP(host)
+		if requestIP == nil {
+			return false
+		}
+		for _, ip := range d.whitelisted {
+			if ip.Equal(requestIP) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func openFDs() int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	return len(entries)
+}
+
+func buildInfo() *BuildInfo {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return nil
+	}
+	b := &BuildInfo{
+		GoVersion: info.GoVersion,
+		Path:      info.Path,
+		Main: Module{
+			Path:    info.Main.Path,
+			Version: info.Main.Version,
+			Sum:     info.Main.Sum,
+		},
+		Settings: map[string]string{},
+		Deps:     make([]Module, 0, len(info.Deps)),
+	}
+	for _, s := range info.Settings {
+		b.Settings[s.Key] = s.Value
+	}
+	for _, dep := range info.Deps {
+		if dep.Replace != nil {
+			dep = dep.Replace
+		}
+		b.Deps = append(b.Deps, Module{Path: dep.Path, Version: dep.Version, Sum: dep.Sum})
+	}
+	return b
+}
+
+// Collect gathers the current diagnostics information.
+func (d *Diagnostics) Collect() *DiagnosticsInfo {
+	mem := runtime.MemStats{}
+	runtime.ReadMemStats(&mem)
+
+	// PauseNs is a circular buffer of the most recent GC pauses:
+	recentPauses := []float64{}
+	for i := uint32(0); i < mem.NumGC && i < 10; i++ {
+		pause := mem.PauseNs[(mem.NumGC-i+255)%256]
+		recentPauses = append(recentPauses, float64(pause)/float64(time.Millisecond))
+	}
+
+	info := &DiagnosticsInfo{
+		Build: buildInfo(),
+		Process: ProcessInfo{
+			PID:           os.Getpid(),
+			StartedAt:     d.startedAt.UTC(),
+			UptimeSeconds: time.Since(d.startedAt).Seconds(),
+			Goroutines:    runtime.NumGoroutine(),
+			NumCPU:        runtime.NumCPU(),
+			GOMAXPROCS:    runtime.GOMAXPROCS(0),
+			OpenFDs:       openFDs(),
+		},
+		Memory: MemoryInfo{
+			Alloc:       mem.Alloc,
+			TotalAlloc:  mem.TotalAlloc,
+			Sys:         mem.Sys,
+			HeapAlloc:   mem.HeapAlloc,
+			HeapInuse:   mem.HeapInuse,
+			HeapObjects: mem.HeapObjects,
+			StackInuse:  mem.StackInuse,
+		},
+		GC: GCInfo{
+			NumGC:          mem.NumGC,
+			PauseTotalMS:   float64(mem.PauseTotalNs) / float64(time.Millisecond),
+			RecentPausesMS: recentPauses,
+		},
+		Config: d.config,
+	}
+	if mem.LastGC > 0 {
+		info.GC.LastGC = time.Unix(0, int64(mem.LastGC)).UTC()
+	}
+	return info
+}
+
+func (info *DiagnosticsInfo) writeText(sb *strings.Builder) {
+	line := func(key string, value interface{}) {
+		sb.WriteString(fmt.Sprintf("%-24s %v\n", key, value))
+	}
+
+	if info.Build != nil {
+		line("go.version", info.Build.GoVersion)
+		line("build.path", info.Build.Path)
+		line("build.main", info.Build.Main.Path+" "+info.Build.Main.Version)
+		keys := make([]string, 0, len(info.Build.Settings))
+		for k := range info.Build.Settings {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			line("build.setting."+k, info.Build.Settings[k])
+		}
+		for _, dep := range info.Build.Deps {
+			line("build.dep", dep.Path+" "+dep.Version)
+		}
+	}
+
+	line("process.pid", info.Process.PID)
+	line("process.startedAt", info.Process.StartedAt.Format(time.RFC3339))
+	line("process.uptime", time.Duration(info.Process.UptimeSeconds*float64(time.Second)).Round(time.Second))
+	line("process.goroutines", info.Process.Goroutines)
+	line("process.numCPU", info.Process.NumCPU)
+	line("process.gomaxprocs", info.Process.GOMAXPROCS)
+	line("process.openFDs", info.Process.OpenFDs)
+
+	line("memory.alloc", info.Memory.Alloc)
+	line("memory.totalAlloc", info.Memory.TotalAlloc)
+	line("memory.sys", info.Memory.Sys)
+	line("memory.heapAlloc", info.Memory.HeapAlloc)
+	line("memory.heapInuse", info.Memory.HeapInuse)
+	line("memory.heapObjects", info.Memory.HeapObjects)
+	line("memory.stackInuse", info.Memory.StackInuse)
+
+	line("gc.numGC", info.GC.NumGC)
+	line("gc.lastGC", info.GC.LastGC.Format(time.RFC3339))
+	line("gc.pauseTotalMs", info.GC.PauseTotalMS)
+	line("gc.recentPausesMs", info.GC.RecentPausesMS)
+
+	keys := make([]string, 0, len(info.Config))
+	for k := range info.Config {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		line("config."+k, info.Config[k])
+	}
+}
+
+func wantsText(r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format == "text"
+	}
+	return strings.HasPrefix(r.Header.Get("Accept"), "text/plain")
+}
+
+// Endpoint is a middleware which answers requests to the diagnostics path.
+//
+// The response is JSON unless the client asks for plain text
+// via ?format=text or an Accept: text/plain header.
+// Unauthorized requests get a 404 Not Found to not reveal the endpoint.
+func (d *Diagnostics) Endpoint(next http.Handler) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != d.path {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !d.isAuthorized(r) {
+				http.NotFound(w, r)
+				return
+			}
+
+			info := d.Collect()
+			w.Header().Set("Cache-Control", "no-store")
+			if wantsText(r) {
+				sb := &strings.Builder{}
+				info.writeText(sb)
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				w.WriteHeader(http.StatusOK)
+				_, _ = fmt.Fprint(w, sb.String())
+				return
+			}
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode(info)
+		})
+}
@@ -5,15 +5,23 @@ import (
 	"net/http"
 )
 
+// Liveness is a middleware which answers requests to the given path with "pong".
+func Liveness(path string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == path {
+					w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+					w.WriteHeader(http.StatusOK)
+					_, _ = fmt.Fprint(w, "pong")
+					return
+				}
+				next.ServeHTTP(w, r)
+			})
+	}
+}
+
+// LivenessProbe is the same as Liveness("/ping").
 func LivenessProbe(next http.Handler) http.Handler {
-	return http.HandlerFunc(
-		func(w http.ResponseWriter, r *http.Request) {
-			if r.URL.Path == "/ping" {
-				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-				w.WriteHeader(http.StatusOK)
-				_, _ = fmt.Fprint(w, "pong")
-				return
-			}
-			next.ServeHTTP(w, r)
-		})
+	return Liveness("/ping")(next)
 }
@@ -0,0 +1,382 @@
+package healthz
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func areEqual[T comparable](t *testing.T, expected, actual T) {
+	if expected != actual {
+		t.Errorf("Expected: %v, Actual: %v", expected, actual)
+	}
+}
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusTeapot)
+})
+
+func serve(handler http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func Test_Liveness(t *testing.T) {
+	handler := LivenessProbe(okHandler)
+	w := serve(handler, httptest.NewRequest(http.MethodGet, "/ping", nil))
+	areEqual(t, http.StatusOK, w.Code)
+	areEqual(t, "pong", w.Body.String())
+
+	w = serve(handler, httptest.NewRequest(http.MethodGet, "/other", nil))
+	areEqual(t, http.StatusTeapot, w.Code)
+}
+
+func Test_Readiness_Probe(t *testing.T) {
+	rd := NewReadiness("/ready", 0).
+		Register("db", time.Second, func(ctx context.Context) error { return nil }).
+		Register("cache", time.Second, func(ctx context.Context) error { return errors.New("connection refused") }).
+		Register("slow", 10*time.Millisecond, func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}).
+		Register("panic", time.Second, func(ctx context.Context) error { panic("boom") })
+
+	w := serve(rd.Probe(okHandler), httptest.NewRequest(http.MethodGet, "/ready", nil))
+	areEqual(t, http.StatusServiceUnavailable, w.Code)
+	areEqual(t, "no-store", w.Header().Get("Cache-Control"))
+
+	report := Report{}
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	areEqual(t, StatusFailing, report.Status)
+	areEqual(t, false, report.Draining)
+	areEqual(t, 4, len(report.Checks))
+	for i, expected := range []CheckResult{
+		{Name: "db", Status: StatusOK},
+		{Name: "cache", Status: StatusFailing, Error: "connection refused"},
+		{Name: "slow", Status: StatusFailing, Error: "check timed out after 10ms"},
+		{Name: "panic", Status: StatusFailing, Error: "check panicked: boom"},
+	} {
+		areEqual(t, expected.Name, report.Checks[i].Name)
+		areEqual(t, expected.Status, report.Checks[i].Status)
+		areEqual(t, expected.Error, report.Checks[i].Error)
+	}
+
+	w = serve(rd.Probe(okHandler), httptest.NewRequest(http.MethodGet, "/other", nil))
+	areEqual(t, http.StatusTeapot, w.Code)
+}
+
+func Test_Readiness_ZeroTimeout(t *testing.T) {
+	rd := NewReadiness("/ready", 0).
+		Register("db", 0, func(ctx context.Context) error { return ctx.Err() })
+
+	report := rd.Check(context.Background())
+	areEqual(t, StatusOK, report.Status)
+	areEqual(t, "", report.Checks[0].Error)
+}
+
+func Test_Readiness_Cache(t *testing.T) {
+	var calls int32
+	rd := NewReadiness("/ready", time.Hour).
+		Register("db", time.Second, func(ctx context.Context) error {
+			atomic.AddInt32(&calls, 1)
+			return nil
+		})
+
+	rd.Check(context.Background())
+	rd.Check(context.Background())
+	areEqual(t, int32(1), atomic.LoadInt32(&calls))
+
+	// Registering a check invalidates the cache:
+	rd.Register("cache", time.Second, func(ctx context.Context) error { return nil })
+	report := rd.Check(context.Background())
+	areEqual(t, int32(2), atomic.LoadInt32(&calls))
+	areEqual(t, 2, len(report.Checks))
+
+	// Results of cancelled probes are not cached:
+	rd = NewReadiness("/ready", time.Hour).
+		Register("db", time.Second, func(ctx context.Context) error { return ctx.Err() })
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	areEqual(t, StatusFailing, rd.Check(ctx).Status)
+	areEqual(t, StatusOK, rd.Check(context.Background()).Status)
+}
+
+func Test_Readiness_ChecksRunWithoutLock(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	rd := NewReadiness("/ready", time.Hour).
+		Register("slow", time.Second, func(ctx context.Context) error {
+			close(started)
+			<-release
+			return nil
+		})
+
+	done := make(chan *Report)
+	go func() {
+		done <- rd.Check(context.Background())
+	}()
+	<-started
+
+	// Registering and draining must not wait for the running check:
+	registered := make(chan struct{})
+	go func() {
+		rd.Register("db", time.Second, func(ctx context.Context) error { return nil })
+		close(registered)
+	}()
+	select {
+	case <-registered:
+	case <-time.After(time.Second):
+		t.Fatal("Register blocked while a check was running")
+	}
+	close(release)
+
+	// The report of the old checks must not be cached:
+	areEqual(t, 1, len((<-done).Checks))
+	areEqual(t, 2, len(rd.Check(context.Background()).Checks))
+}
+
+func Test_Readiness_Draining(t *testing.T) {
+	called := false
+	rd := NewReadiness("/ready", 0).
+		Register("db", time.Second, func(ctx context.Context) error {
+			called = true
+			return nil
+		})
+	rd.SetDraining(true)
+	areEqual(t, true, rd.Draining())
+
+	w := serve(rd.Probe(okHandler), httptest.NewRequest(http.MethodGet, "/ready", nil))
+	areEqual(t, http.StatusServiceUnavailable, w.Code)
+	report := Report{}
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	areEqual(t, StatusDraining, report.Status)
+	areEqual(t, true, report.Draining)
+	areEqual(t, false, called)
+
+	rd.SetDraining(false)
+	w = serve(rd.Probe(okHandler), httptest.NewRequest(http.MethodGet, "/ready", nil))
+	areEqual(t, http.StatusOK, w.Code)
+	areEqual(t, true, called)
+}
+
+// startServer serves the handler on a random port and returns the server and its URL.
+func startServer(t *testing.T, handler http.Handler) (*http.Server, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: time.Second}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(func() {
+		_ = server.Close()
+	})
+	return server, "http://" + listener.Addr().String()
+}
+
+func get(url string) (int, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+func Test_Shutdown_Drain(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	rd := NewReadiness("/ready", 0)
+	handler := LivenessProbe(rd.Probe(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})))
+	server, url := startServer(t, handler)
+
+	status, err := get(url + "/ready")
+	areEqual(t, true, err == nil)
+	areEqual(t, http.StatusOK, status)
+
+	inFlight := make(chan int)
+	go func() {
+		status, _ := get(url + "/slow")
+		inFlight <- status
+	}()
+	<-started
+
+	shutdown := &Shutdown{Server: server, Readiness: rd, DrainDelay: 100 * time.Millisecond, Timeout: 5 * time.Second}
+	drained := make(chan error)
+	go func() {
+		drained <- shutdown.Drain(context.Background())
+	}()
+
+	// During the drain delay the readiness probe fails while the liveness probe stays healthy:
+	deadline := time.Now().Add(time.Second)
+	for !rd.Draining() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	status, err = get(url + "/ready")
+	areEqual(t, true, err == nil)
+	areEqual(t, http.StatusServiceUnavailable, status)
+	status, err = get(url + "/ping")
+	areEqual(t, true, err == nil)
+	areEqual(t, http.StatusOK, status)
+
+	// In-flight requests complete before the server shuts down:
+	time.Sleep(150 * time.Millisecond)
+	select {
+	case <-drained:
+		t.Fatal("Expected Drain to wait for the in-flight request")
+	default:
+	}
+	close(release)
+	areEqual(t, http.StatusOK, <-inFlight)
+	areEqual(t, true, <-drained == nil)
+
+	_, err = get(url + "/ping")
+	areEqual(t, true, err != nil)
+}
+
+func Test_Shutdown_CancelSkipsDrainDelay(t *testing.T) {
+	server, _ := startServer(t, okHandler)
+	shutdown := &Shutdown{Server: server, DrainDelay: time.Hour}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	areEqual(t, true, shutdown.Drain(ctx) == nil)
+	areEqual(t, true, time.Since(start) < time.Second)
+}
+
+func Test_Shutdown_Timeout(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	server, url := startServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	go func() {
+		_, _ = get(url)
+	}()
+	<-started
+
+	shutdown := &Shutdown{Server: server, Timeout: 50 * time.Millisecond}
+	err := shutdown.Drain(context.Background())
+	areEqual(t, true, errors.Is(err, context.DeadlineExceeded))
+}
+
+func Test_Diagnostics_Access(t *testing.T) {
+	d := NewDiagnostics("/debug", nil).
+		AllowIPs(net.ParseIP("10.0.0.1"), net.ParseIP("::1")).
+		RequireToken("secret")
+	handler := d.Endpoint(okHandler)
+
+	testCases := []struct {
+		name          string
+		remoteAddr    string
+		authorization string
+		status        int
+	}{
+		{"whitelisted IP", "10.0.0.1:1234", "", http.StatusOK},
+		{"whitelisted IPv6", "[::1]:1234", "", http.StatusOK},
+		{"whitelisted IP without port", "10.0.0.1", "", http.StatusOK},
+		{"valid token", "192.0.2.1:1234", "Bearer secret", http.StatusOK},
+		{"invalid token", "192.0.2.1:1234", "Bearer wrong", http.StatusNotFound},
+		{"token without scheme", "192.0.2.1:1234", "secret", http.StatusNotFound},
+		{"unknown IP", "192.0.2.1:1234", "", http.StatusNotFound},
+		{"invalid remote address", "unknown", "", http.StatusNotFound},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/debug", nil)
+			req.RemoteAddr = tc.remoteAddr
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			areEqual(t, tc.status, serve(handler, req).Code)
+		})
+	}
+
+	// Access must be granted explicitly:
+	req := httptest.NewRequest(http.MethodGet, "/debug", nil)
+	req.RemoteAddr = "127.0.0.1:1234"
+	areEqual(t, http.StatusNotFound, serve(NewDiagnostics("/debug", nil).Endpoint(okHandler), req).Code)
+
+	// Other paths are passed on:
+	areEqual(t, http.StatusTeapot, serve(handler, httptest.NewRequest(http.MethodGet, "/other", nil)).Code)
+}
+
+func Test_Diagnostics_Output(t *testing.T) {
+	d := NewDiagnostics("/debug", map[string]interface{}{"compression": "gzip", "maxBodySize": 1024}).
+		RequireToken("secret")
+	handler := d.Endpoint(okHandler)
+
+	req := httptest.NewRequest(http.MethodGet, "/debug", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := serve(handler, req)
+	areEqual(t, http.StatusOK, w.Code)
+	areEqual(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	areEqual(t, "no-store", w.Header().Get("Cache-Control"))
+
+	info := DiagnosticsInfo{}
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+		t.Fatal(err)
+	}
+	areEqual(t, os.Getpid(), info.Process.PID)
+	areEqual(t, true, info.Process.Goroutines > 0)
+	areEqual(t, runtime.NumCPU(), info.Process.NumCPU)
+	areEqual(t, true, info.Process.UptimeSeconds >= 0)
+	areEqual(t, true, info.Memory.Sys > 0)
+	areEqual(t, true, info.Config["compression"] == "gzip")
+	areEqual(t, true, info.Config["maxBodySize"] == float64(1024))
+	if info.Build != nil {
+		areEqual(t, runtime.Version(), info.Build.GoVersion)
+	}
+
+	for _, configure := range []func(r *http.Request){
+		func(r *http.Request) { r.URL.RawQuery = "format=text" },
+		func(r *http.Request) { r.Header.Set("Accept", "text/plain") },
+	} {
+		req = httptest.NewRequest(http.MethodGet, "/debug", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		configure(req)
+		w = serve(handler, req)
+		areEqual(t, http.StatusOK, w.Code)
+		areEqual(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+
+		lines := map[string]string{}
+		for _, line := range strings.Split(strings.TrimSpace(w.Body.String()), "\n") {
+			fields := strings.SplitN(line, " ", 2)
+			lines[fields[0]] = strings.TrimSpace(fields[1])
+		}
+		areEqual(t, strconv.Itoa(os.Getpid()), lines["process.pid"])
+		areEqual(t, "gzip", lines["config.compression"])
+		areEqual(t, "1024", lines["config.maxBodySize"])
+	}
+
+	// The format parameter takes precedence over the Accept header:
+	req = httptest.NewRequest(http.MethodGet, "/debug?format=json", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Accept", "text/plain")
+	areEqual(t, "application/json; charset=utf-8", serve(handler, req).Header().Get("Content-Type"))
+}
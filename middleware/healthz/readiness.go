@@ -0,0 +1,216 @@
+package healthz
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK       = "ok"
+	StatusFailing  = "failing"
+	StatusDraining = "draining"
+)
+
+// DefaultCheckTimeout is used for checks which have been registered without a timeout.
+const DefaultCheckTimeout = 5 * time.Second
+
+// CheckFunc returns an error if a dependency of the service is not available.
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name    string
+	timeout time.Duration
+	f       CheckFunc
+}
+
+// CheckResult is the outcome of a single readiness check.
+type CheckResult struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	Error     string  `json:"error,omitempty"`
+	LatencyMS float64 `json:"latencyMs"`
+}
+
+// Report is the outcome of all readiness checks.
+type Report struct {
+	Status    string        `json:"status"`
+	Draining  bool          `json:"draining"`
+	CheckedAt time.Time     `json:"checkedAt"`
+	Checks    []CheckResult `json:"checks"`
+}
+
+// Readiness runs registered dependency checks to determine
+// if a service is ready to receive traffic.
+type Readiness struct {
+	path     string
+	cacheTTL time.Duration
+	draining int32
+
+	mutex    sync.Mutex
+	checks   []check
+	version  int
+	cached   *Report
+	cachedAt time.Time
+}
+
+// NewReadiness creates a readiness probe which answers requests to the given path.
+//
+// Results are cached for the duration of cacheTTL so that
+// frequent probes don't overload the checked dependencies.
+func NewReadiness(path string, cacheTTL time.Duration) *Readiness {
+	return &Readiness{
+		path:     path,
+		cacheTTL: cacheTTL,
+	}
+}
+
+// Register adds a named check which must complete within the given timeout.
+// The DefaultCheckTimeout is used if the timeout is zero or negative.
+func (rd *Readiness) Register(name string, timeout time.Duration, f CheckFunc) *Readiness {
+	if timeout <= 0 {
+		timeout = DefaultCheckTimeout
+	}
+
+	rd.mutex.Lock()
+	defer rd.mutex.Unlock()
+
+	rd.checks = append(rd.checks, check{name: name, timeout: timeout, f: f})
+	rd.version++
+	rd.cached = nil
+	return rd
+}
+
+// SetDraining marks the service as draining, which fails the readiness
+// probe without running any checks, so that no new traffic gets routed to it.
+func (rd *Readiness) SetDraining(draining bool) {
+	var v int32
+	if draining {
+		v = 1
+	}
+	atomic.StoreInt32(&rd.draining, v)
+}
+
+// Draining returns true if the service is shutting down.
+func (rd *Readiness) Draining() bool {
+	return atomic.LoadInt32(&rd.draining) == 1
+}
+
+func runCheck(ctx context.Context, c check) (result CheckResult) {
+	start := time.Now()
+	result = CheckResult{Name: c.name, Status: StatusOK}
+	defer func() {
+		result.LatencyMS = float64(time.Since(start).Microseconds()) / 1000
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	errs := make(chan error, 1)
+	go func() {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				errs <- fmt.Errorf("check panicked: %v", recovered)
+			}
+		}()
+		errs <- c.f(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+		err = fmt.Errorf("check timed out after %s", c.timeout)
+	}
+	if err != nil {
+		result.Status = StatusFailing
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Check runs all registered checks concurrently, unless a cached report is still valid.
+func (rd *Readiness) Check(ctx context.Context) *Report {
+	if rd.Draining() {
+		return &Report{
+			Status:    StatusDraining,
+			Draining:  true,
+			CheckedAt: time.Now().UTC(),
+			Checks:    []CheckResult{},
+		}
+	}
+
+	// Don't hold the lock while the checks run, which would block
+	// concurrent probes and registrations until the slowest check completed:
+	rd.mutex.Lock()
+	if rd.cached != nil && time.Since(rd.cachedAt) < rd.cacheTTL {
+		cached := rd.cached
+		rd.mutex.Unlock()
+		return cached
+	}
+	checks := append([]check{}, rd.checks...)
+	version := rd.version
+	rd.mutex.Unlock()
+
+	results := make([]CheckResult, len(checks))
+	wg := sync.WaitGroup{}
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c check) {
+			defer wg.Done()
+			results[i] = runCheck(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := &Report{
+		Status:    StatusOK,
+		CheckedAt: time.Now().UTC(),
+		Checks:    results,
+	}
+	for _, result := range results {
+		if result.Status != StatusOK {
+			report.Status = StatusFailing
+			break
+		}
+	}
+
+	// Don't cache results of a probe which has been cancelled by the caller
+	// or which are missing checks that have been registered in the meantime:
+	rd.mutex.Lock()
+	defer rd.mutex.Unlock()
+	if ctx.Err() == nil && version == rd.version {
+		rd.cached = report
+		rd.cachedAt = time.Now()
+	}
+	return report
+}
+
+func writeReport(w http.ResponseWriter, report *Report, healthy bool) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if healthy {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+// Probe is a middleware which answers requests to the readiness path
+// with 200 or 503 and a JSON body listing the status of each check.
+func (rd *Readiness) Probe(next http.Handler) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == rd.path {
+				report := rd.Check(r.Context())
+				writeReport(w, report, report.Status == StatusOK)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+}
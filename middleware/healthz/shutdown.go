@@ -0,0 +1,85 @@
+package healthz
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Shutdown coordinates the graceful shutdown of a http.Server:
+//
+// 1. The readiness probe starts failing while the liveness probe stays healthy.
+//
+// 2. After the DrainDelay the server stops accepting new connections.
+// The delay gives load balancers (e.g. Kubernetes) time to notice the failing
+// readiness probe and to stop routing new requests to the service.
+//
+// 3. In-flight requests are given up to Timeout to complete before the server gets closed.
+type Shutdown struct {
+	Server     *http.Server
+	Readiness  *Readiness
+	DrainDelay time.Duration
+	Timeout    time.Duration
+}
+
+// Drain runs the shutdown sequence and returns once the server has been shut down.
+// Cancelling ctx skips the remaining drain delay.
+func (s *Shutdown) Drain(ctx context.Context) error {
+	if s.Readiness != nil {
+		s.Readiness.SetDraining(true)
+	}
+
+	if s.DrainDelay > 0 {
+		timer := time.NewTimer(s.DrainDelay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+
+	shutdownCtx := context.Background()
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, s.Timeout)
+		defer cancel()
+	}
+
+	if err := s.Server.Shutdown(shutdownCtx); err != nil {
+		_ = s.Server.Close()
+		return fmt.Errorf("error shutting down HTTP server gracefully: %w", err)
+	}
+	return nil
+}
+
+// WaitForSignal blocks until one of the given signals has been received and then drains the server.
+// It listens for SIGINT and SIGTERM if no signals are given.
+//
+// A second signal during the drain delay skips the remaining delay.
+func (s *Shutdown) WaitForSignal(signals ...os.Signal) error {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+
+	received := make(chan os.Signal, 2)
+	signal.Notify(received, signals...)
+	defer signal.Stop(received)
+
+	<-received
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-received:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return s.Drain(ctx)
+}
@@ -0,0 +1,142 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dusted-go/http/v6/middleware/mware"
+)
+
+// NoRoute is the route label of requests which haven't been named by SetRoute.
+const NoRoute = "none"
+
+var (
+	// DurationBuckets are the default buckets of the request duration histogram in seconds.
+	DurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+	// SizeBuckets are the default buckets of the response size histogram in bytes.
+	SizeBuckets = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
+)
+
+type routeKey struct{}
+
+type route struct {
+	name string
+}
+
+// SetRoute sets the route label of the current request.
+//
+// Routes should be named after a handler (e.g. "blog-post") rather than the
+// request path, because every distinct value creates a new time series.
+func SetRoute(r *http.Request, name string) {
+	if rt, ok := r.Context().Value(routeKey{}).(*route); ok {
+		rt.name = name
+	}
+}
+
+// Route is a middleware which sets the route label of all requests passing through it.
+func Route(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				SetRoute(r, name)
+				next.ServeHTTP(w, r)
+			})
+	}
+}
+
+// Metrics records request metrics into a Registry.
+type Metrics struct {
+	requests *Counter
+	inFlight *Gauge
+	duration *Histogram
+	size     *Histogram
+}
+
+// New registers the HTTP request metrics with the given registry.
+//
+// The registry can be used by other middlewares to register their own metrics
+// and should be exposed with Registry.Handler.
+func New(registry *Registry) *Metrics {
+	labelNames := []string{"method", "status", "route"}
+	return &Metrics{
+		requests: registry.NewCounter(
+			"http_requests_total",
+			"Total number of HTTP requests.",
+			labelNames...),
+		inFlight: registry.NewGauge(
+			"http_requests_in_flight",
+			"Number of HTTP requests which are currently being served."),
+		duration: registry.NewHistogram(
+			"http_request_duration_seconds",
+			"Duration of HTTP requests in seconds.",
+			DurationBuckets,
+			labelNames...),
+		size: registry.NewHistogram(
+			"http_response_size_bytes",
+			"Size of HTTP response bodies in bytes.",
+			SizeBuckets,
+			labelNames...),
+	}
+}
+
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+func method(m string) string {
+	switch m {
+	case http.MethodGet,
+		http.MethodHead,
+		http.MethodPost,
+		http.MethodPut,
+		http.MethodPatch,
+		http.MethodDelete,
+		http.MethodConnect,
+		http.MethodOptions,
+		http.MethodTrace:
+		return m
+	default:
+		// Prevent arbitrary methods from creating new time series:
+		return "OTHER"
+	}
+}
+
+// Collect is a middleware which records the count, latency and
+// response size of all requests labeled by method, status class and route.
+func (m *Metrics) Collect(next http.Handler) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rt := &route{name: NoRoute}
+			rw := mware.NewResponseWriter(w)
+
+			m.inFlight.Add(1)
+			defer func() {
+				m.inFlight.Add(-1)
+
+				status := rw.Status()
+				if status == 0 {
+					// Nothing has been written, which net/http answers with a 200:
+					status = http.StatusOK
+				}
+				if recovered := recover(); recovered != nil {
+					status = http.StatusInternalServerError
+					defer panic(recovered)
+				}
+
+				labelValues := []string{method(r.Method), statusClass(status), rt.name}
+				m.requests.Inc(labelValues...)
+				m.duration.Observe(time.Since(start).Seconds(), labelValues...)
+				m.size.Observe(float64(rw.BytesWritten()), labelValues...)
+			}()
+
+			ctx := context.WithValue(r.Context(), routeKey{}, rt)
+			next.ServeHTTP(rw, r.WithContext(ctx))
+		})
+}
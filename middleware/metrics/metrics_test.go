@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func areEqual[T comparable](t *testing.T, expected, actual T) {
+	if expected != actual {
+		t.Errorf("Expected: %v, Actual: %v", expected, actual)
+	}
+}
+
+func Test_Registry_WriteTo(t *testing.T) {
+	registry := NewRegistry()
+	blocked := registry.NewCounter("firewall_blocked_total", "Blocked requests.", "reason")
+	latency := registry.NewHistogram("job_seconds", "Job latency.", []float64{0.5, 1})
+
+	blocked.Inc("ip")
+	blocked.Add(2, `bad "value"`)
+	latency.Observe(0.25)
+	latency.Observe(0.75)
+
+	buf := &bytes.Buffer{}
+	if _, err := registry.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP firewall_blocked_total Blocked requests.
+# TYPE firewall_blocked_total counter
+firewall_blocked_total{reason="bad \"value\""} 2
+firewall_blocked_total{reason="ip"} 1
+# HELP job_seconds Job latency.
+# TYPE job_seconds histogram
+job_seconds_bucket{le="0.5"} 1
+job_seconds_bucket{le="1"} 2
+job_seconds_bucket{le="+Inf"} 2
+job_seconds_sum 1
+job_seconds_count 2
+`
+	areEqual(t, expected, buf.String())
+}
+
+func Test_Metrics_Collect(t *testing.T) {
+	registry := NewRegistry()
+	m := New(registry)
+
+	handler := m.Collect(
+		Route("posts")(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte("not found"))
+			})))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/posts/1", nil))
+
+	buf := &bytes.Buffer{}
+	if _, err := registry.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	output := buf.String()
+
+	for _, line := range []string{
+		`http_requests_total{method="GET",status="4xx",route="posts"} 1`,
+		`http_response_size_bytes_sum{method="GET",status="4xx",route="posts"} 9`,
+		`http_requests_in_flight 0`,
+	} {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("Expected output to contain: %s", line)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+// collector writes a single metric family in the Prometheus text format.
+type collector interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+// Registry holds metrics and exposes them in the Prometheus text exposition format.
+type Registry struct {
+	mutex      sync.RWMutex
+	collectors map[string]collector
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{collectors: map[string]collector{}}
+}
+
+func (r *Registry) register(c collector) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.collectors[c.name()]; ok {
+		panic(fmt.Sprintf("metrics: a metric with the name '%s' has already been registered", c.name()))
+	}
+	r.collectors[c.name()] = c
+}
+
+// WriteTo writes all metrics of the registry in the Prometheus text exposition format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mutex.RLock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	collectors := make([]collector, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		collectors = append(collectors, r.collectors[name])
+	}
+	r.mutex.RUnlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	if err := bw.Flush(); err != nil {
+		return cw.n, fmt.Errorf("error writing metrics: %w", err)
+	}
+	return cw.n, nil
+}
+
+// Handler returns a http.Handler which serves the metrics of the registry.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+			w.Header().Set("Cache-Control", "no-store")
+			w.WriteHeader(http.StatusOK)
+			_, _ = r.WriteTo(w)
+		})
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	// nolint: wrapcheck // Must behave like the wrapped writer
+	return n, err
+}
+
+// labels is a metric's set of label names together with one set of values.
+type labels struct {
+	names  []string
+	values []string
+}
+
+func (l labels) key() string {
+	return strings.Join(l.values, "\xff")
+}
+
+func (l labels) String() string {
+	return l.with("", "")
+}
+
+// with renders the labels and an optional extra label (e.g. the le label of a histogram bucket).
+func (l labels) with(extraName, extraValue string) string {
+	if len(l.names) == 0 && extraName == "" {
+		return ""
+	}
+	pairs := make([]string, 0, len(l.names)+1)
+	for i, name := range l.names {
+		pairs = append(pairs, name+`="`+escapeLabelValue(l.values[i])+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+escapeLabelValue(extraValue)+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var (
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+func writeHeader(w *bufio.Writer, name, help, metricType string) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n", name, helpEscaper.Replace(help))
+	_, _ = fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+}
+
+// family is the shared implementation of all metric types,
+// which keeps one series per distinct set of label values.
+type family struct {
+	metricName string
+	help       string
+	labelNames []string
+
+	mutex  sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labels  labels
+	value   float64
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+func newFamily(name, help string, labelNames []string) *family {
+	return &family{
+		metricName: name,
+		help:       help,
+		labelNames: labelNames,
+		series:     map[string]*series{},
+	}
+}
+
+func (f *family) name() string {
+	return f.metricName
+}
+
+// get returns the series for the given label values. The caller must hold the mutex.
+func (f *family) get(labelValues []string) *series {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf(
+			"metrics: %s expects %d label values but got %d",
+			f.metricName, len(f.labelNames), len(labelValues)))
+	}
+	l := labels{names: f.labelNames, values: labelValues}
+	s, ok := f.series[l.key()]
+	if !ok {
+		values := make([]string, len(labelValues))
+		copy(values, labelValues)
+		s = &series{labels: labels{names: f.labelNames, values: values}}
+		f.series[l.key()] = s
+	}
+	return s
+}
+
+// sorted returns a snapshot of all series ordered by their labels. The caller must hold the mutex.
+func (f *family) sorted() []series {
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	snapshot := make([]series, 0, len(keys))
+	for _, k := range keys {
+		s := *f.series[k]
+		s.buckets = append([]uint64{}, s.buckets...)
+		snapshot = append(snapshot, s)
+	}
+	return snapshot
+}
+
+// Counter is a metric which only ever increases.
+type Counter struct {
+	*family
+}
+
+// NewCounter registers a new counter with the given label names.
+func (r *Registry) NewCounter(name, help string, labelNames ...string) *Counter {
+	c := &Counter{family: newFamily(name, help, labelNames)}
+	r.register(c)
+	return c
+}
+
+// Inc increments the counter of the given label values by one.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increments the counter of the given label values by v, which must not be negative.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("metrics: counters cannot decrease")
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.get(labelValues).value += v
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.mutex.Lock()
+	snapshot := c.sorted()
+	c.mutex.Unlock()
+
+	writeHeader(w, c.metricName, c.help, typeCounter)
+	for _, s := range snapshot {
+		_, _ = fmt.Fprintf(w, "%s%s %s\n", c.metricName, s.labels, formatFloat(s.value))
+	}
+}
+
+// Gauge is a metric which can go up and down.
+type Gauge struct {
+	*family
+}
+
+// NewGauge registers a new gauge with the given label names.
+func (r *Registry) NewGauge(name, help string, labelNames ...string) *Gauge {
+	g := &Gauge{family: newFamily(name, help, labelNames)}
+	r.register(g)
+	return g
+}
+
+// Set sets the gauge of the given label values to v.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.get(labelValues).value = v
+}
+
+// Add adds v (which can be negative) to the gauge of the given label values.
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.get(labelValues).value += v
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.mutex.Lock()
+	snapshot := g.sorted()
+	g.mutex.Unlock()
+
+	writeHeader(w, g.metricName, g.help, typeGauge)
+	for _, s := range snapshot {
+		_, _ = fmt.Fprintf(w, "%s%s %s\n", g.metricName, s.labels, formatFloat(s.value))
+	}
+}
+
+// Histogram counts observations in configurable buckets.
+type Histogram struct {
+	*family
+	upperBounds []float64
+}
+
+// NewHistogram registers a new histogram with the given bucket upper bounds and label names.
+// The +Inf bucket is added automatically.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	upperBounds := append([]float64{}, buckets...)
+	sort.Float64s(upperBounds)
+	h := &Histogram{
+		family:      newFamily(name, help, labelNames),
+		upperBounds: upperBounds,
+	}
+	r.register(h)
+	return h
+}
+
+// Observe adds a single observation to the histogram of the given label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	s := h.get(labelValues)
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(h.upperBounds))
+	}
+	for i, upperBound := range h.upperBounds {
+		if v <= upperBound {
+			s.buckets[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mutex.Lock()
+	snapshot := h.sorted()
+	h.mutex.Unlock()
+
+	writeHeader(w, h.metricName, h.help, typeHistogram)
+	for _, s := range snapshot {
+		for i, upperBound := range h.upperBounds {
+			_, _ = fmt.Fprintf(w, "%s_bucket%s %d\n",
+				h.metricName, s.labels.with("le", formatFloat(upperBound)), s.buckets[i])
+		}
+		_, _ = fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, s.labels.with("le", "+Inf"), s.count)
+		_, _ = fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, s.labels, formatFloat(s.sum))
+		_, _ = fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, s.labels, s.count)
+	}
+}
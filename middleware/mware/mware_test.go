@@ -0,0 +1,135 @@
+package mware
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func areEqual[T comparable](t *testing.T, expected, actual T) {
+	if expected != actual {
+		t.Errorf("Expected: %v, Actual: %v", expected, actual)
+	}
+}
+
+func Test_Bind(t *testing.T) {
+	order := ""
+	middleware := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order += name
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	handler := Bind(middleware("a"), nil, middleware("b"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order += "!"
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	areEqual(t, "ab!", order)
+}
+
+func Test_ResponseWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := NewResponseWriter(rec)
+	areEqual(t, w, NewResponseWriter(w))
+
+	calls := []int{}
+	w.BeforeWriteHeader(func(status int) {
+		calls = append(calls, status)
+		w.Header().Set("X-Status-Seen", "yes")
+	})
+	areEqual(t, false, w.Committed())
+	areEqual(t, 0, w.Status())
+
+	w.WriteHeader(http.StatusCreated)
+	w.WriteHeader(http.StatusInternalServerError)
+	_, _ = io.WriteString(w, "hello")
+	_, _ = io.WriteString(w, " world")
+
+	areEqual(t, true, w.Committed())
+	areEqual(t, http.StatusCreated, w.Status())
+	areEqual(t, int64(11), w.BytesWritten())
+	areEqual(t, 1, len(calls))
+	areEqual(t, http.StatusCreated, calls[0])
+	areEqual(t, "yes", rec.Header().Get("X-Status-Seen"))
+	areEqual(t, "hello world", rec.Body.String())
+	areEqual(t, true, w.Unwrap() == http.ResponseWriter(rec))
+}
+
+func Test_ResponseWriter_InformationalStatus(t *testing.T) {
+	w := NewResponseWriter(httptest.NewRecorder())
+	called := false
+	w.BeforeWriteHeader(func(int) { called = true })
+
+	// Informational responses don't commit the response:
+	w.WriteHeader(http.StatusEarlyHints)
+	areEqual(t, false, w.Committed())
+	areEqual(t, false, called)
+
+	w.WriteHeader(http.StatusOK)
+	areEqual(t, true, w.Committed())
+	areEqual(t, true, called)
+}
+
+func Test_ResponseWriter_ImplicitStatus(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := NewResponseWriter(rec)
+	w.Flush()
+	areEqual(t, http.StatusOK, w.Status())
+	areEqual(t, true, rec.Flushed)
+}
+
+func Test_ResponseWriter_SniffsContentType(t *testing.T) {
+	testCases := []struct {
+		name     string
+		header   http.Header
+		body     string
+		expected string
+	}{
+		{"html", http.Header{}, "<!DOCTYPE html><html></html>", "text/html; charset=utf-8"},
+		{"text", http.Header{}, "hello", "text/plain; charset=utf-8"},
+		{"explicit", http.Header{"Content-Type": {"application/json"}}, "<html>", "application/json"},
+		{"sniffing disabled", http.Header{"Content-Type": nil}, "<html>", ""},
+		{"encoded", http.Header{"Content-Encoding": {"gzip"}}, "<html>", ""},
+		{"empty", http.Header{}, "", ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := NewResponseWriter(httptest.NewRecorder())
+			for name, values := range tc.header {
+				w.Header()[name] = values
+			}
+			seen := "unset"
+			w.BeforeWriteHeader(func(int) {
+				seen = w.Header().Get("Content-Type")
+			})
+			_, _ = w.Write([]byte(tc.body))
+			areEqual(t, tc.expected, seen)
+		})
+	}
+}
+
+type hijackableRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (h hijackableRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, nil
+}
+
+func Test_ResponseWriter_Hijack(t *testing.T) {
+	w := NewResponseWriter(httptest.NewRecorder())
+	_, _, err := w.Hijack()
+	areEqual(t, true, err != nil)
+	areEqual(t, false, w.Committed())
+
+	w = NewResponseWriter(hijackableRecorder{httptest.NewRecorder()})
+	_, _, err = w.Hijack()
+	areEqual(t, true, err == nil)
+	areEqual(t, true, w.Committed())
+	areEqual(t, http.StatusSwitchingProtocols, w.Status())
+}
@@ -0,0 +1,29 @@
+package mware
+
+import (
+	"net/http"
+	"strings"
+)
+
+// IsHTTP reports whether the request has been received over HTTP/1.x, HTTP/2 or HTTP/3.
+func IsHTTP(r *http.Request) bool {
+	return strings.HasPrefix(r.Proto, "HTTP/")
+}
+
+// RequestURI returns the escaped path and query of a request in origin form (e.g. /a%20b?c=d).
+//
+// It's taken from the RequestURI as sent by the client (or the :path pseudo-header
+// of HTTP/2 and HTTP/3 requests) and is rebuilt from the URL for requests without
+// a RequestURI (e.g. requests created by other handlers) or with a RequestURI in
+// absolute, authority or asterisk form.
+func RequestURI(r *http.Request) string {
+	if strings.HasPrefix(r.RequestURI, "/") {
+		return r.RequestURI
+	}
+	u := *r.URL
+	u.Scheme = ""
+	u.Host = ""
+	u.User = nil
+	u.Opaque = ""
+	return u.RequestURI()
+}
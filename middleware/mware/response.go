@@ -0,0 +1,120 @@
+package mware
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// ResponseWriter wraps a http.ResponseWriter and keeps track of the
+// status code and the number of bytes which have been written.
+//
+// Middlewares can register callbacks which run right before the
+// header gets written, which is the last chance to modify it.
+type ResponseWriter struct {
+	http.ResponseWriter
+
+	status            int
+	bytesWritten      int64
+	beforeWriteHeader []func(status int)
+}
+
+// NewResponseWriter wraps the given http.ResponseWriter.
+// If w is already a *ResponseWriter then it gets returned as is.
+func NewResponseWriter(w http.ResponseWriter) *ResponseWriter {
+	if rw, ok := w.(*ResponseWriter); ok {
+		return rw
+	}
+	return &ResponseWriter{ResponseWriter: w}
+}
+
+// BeforeWriteHeader registers a function which gets called with the
+// final status code right before the header gets written.
+func (w *ResponseWriter) BeforeWriteHeader(f func(status int)) {
+	w.beforeWriteHeader = append(w.beforeWriteHeader, f)
+}
+
+// Status returns the status code of the response or 0 if it hasn't been written yet.
+func (w *ResponseWriter) Status() int {
+	return w.status
+}
+
+// BytesWritten returns the number of bytes of the response body which have been written.
+func (w *ResponseWriter) BytesWritten() int64 {
+	return w.bytesWritten
+}
+
+// Committed returns true if the header has been sent to the client already.
+func (w *ResponseWriter) Committed() bool {
+	return w.status != 0
+}
+
+func (w *ResponseWriter) WriteHeader(status int) {
+	if w.Committed() {
+		return
+	}
+	// Informational responses (e.g. 103 Early Hints) don't commit the response:
+	if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	for _, f := range w.beforeWriteHeader {
+		f(status)
+	}
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// sniffContentType sets the Content-Type which net/http would detect from the body,
+// so that the BeforeWriteHeader callbacks see the content type which gets sent.
+func (w *ResponseWriter) sniffContentType(b []byte) {
+	h := w.Header()
+	if _, ok := h["Content-Type"]; ok || len(b) == 0 {
+		return
+	}
+	if h.Get("Content-Encoding") != "" || h.Get("Transfer-Encoding") != "" {
+		return
+	}
+	h.Set("Content-Type", http.DetectContentType(b))
+}
+
+func (w *ResponseWriter) Write(b []byte) (int, error) {
+	if !w.Committed() {
+		w.sniffContentType(b)
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytesWritten += int64(n)
+	// nolint: wrapcheck // Must behave like the wrapped writer
+	return n, err
+}
+
+// Flush implements http.Flusher if the wrapped writer supports it.
+func (w *ResponseWriter) Flush() {
+	if !w.Committed() {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker if the wrapped writer supports it.
+func (w *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("the wrapped http.ResponseWriter does not implement http.Hijacker")
+	}
+	conn, rw, err := h.Hijack()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error hijacking connection: %w", err)
+	}
+	w.status = http.StatusSwitchingProtocols
+	return conn, rw, nil
+}
+
+// Unwrap returns the wrapped http.ResponseWriter.
+func (w *ResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
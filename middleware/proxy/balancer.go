@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"hash/fnv"
+	"net/http"
+	"sync/atomic"
+)
+
+// Balancer picks one of the healthy upstreams for a request.
+// The list of upstreams is never empty.
+type Balancer interface {
+	Next(r *http.Request, upstreams []*Upstream) *Upstream
+}
+
+type roundRobin struct {
+	counter uint64
+}
+
+// RoundRobin returns a Balancer which cycles through all upstreams in turn.
+func RoundRobin() Balancer {
+	return &roundRobin{}
+}
+
+func (b *roundRobin) Next(_ *http.Request, upstreams []*Upstream) *Upstream {
+	n := atomic.AddUint64(&b.counter, 1) - 1
+	return upstreams[n%uint64(len(upstreams))]
+}
+
+type leastConnections struct {
+	fallback Balancer
+}
+
+// LeastConnections returns a Balancer which picks the upstream with the fewest active requests.
+// Ties are broken in round robin order.
+func LeastConnections() Balancer {
+	return &leastConnections{fallback: RoundRobin()}
+}
+
+func (b *leastConnections) Next(r *http.Request, upstreams []*Upstream) *Upstream {
+	least := []*Upstream{}
+	fewest := int64(-1)
+	for _, u := range upstreams {
+		active := u.ActiveRequests()
+		switch {
+		case fewest == -1 || active < fewest:
+			fewest = active
+			least = []*Upstream{u}
+		case active == fewest:
+			least = append(least, u)
+		}
+	}
+	return b.fallback.Next(r, least)
+}
+
+type consistentHash struct {
+	key func(r *http.Request) string
+}
+
+// ConsistentHash returns a Balancer which always picks the same upstream for the same key
+// (e.g. a session cookie or the client IP), as long as that upstream is healthy.
+//
+// It uses rendezvous hashing, so that only the keys of an upstream
+// which becomes unavailable get moved to other upstreams.
+func ConsistentHash(key func(r *http.Request) string) Balancer {
+	return &consistentHash{key: key}
+}
+
+func (b *consistentHash) Next(r *http.Request, upstreams []*Upstream) *Upstream {
+	key := b.key(r)
+	var best *Upstream
+	var bestScore uint64
+	for _, u := range upstreams {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(key))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(u.URL.String()))
+		if score := h.Sum64(); best == nil || score > bestScore {
+			best = u
+			bestScore = score
+		}
+	}
+	return best
+}
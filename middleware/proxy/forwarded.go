@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ForwardedElement is a single hop of a RFC 7239 Forwarded header.
+//
+// For and By contain a node identifier, which is either an IP address
+// with an optional port, "unknown" or an obfuscated identifier (e.g. _hidden).
+type ForwardedElement struct {
+	For   string
+	By    string
+	Host  string
+	Proto string
+}
+
+// IP returns the IP address of the For node or nil if it is unknown or obfuscated.
+func (e ForwardedElement) IP() net.IP {
+	return parseNodeIP(e.For)
+}
+
+// parseNodeIP parses a node identifier such as 192.0.2.43, 192.0.2.43:47011 or [2001:db8::17]:4711.
+func parseNodeIP(node string) net.IP {
+	if node == "" || node == "unknown" || strings.HasPrefix(node, "_") {
+		return nil
+	}
+	return parseIP(node)
+}
+
+// splitQuoted splits s by sep, ignoring separators inside quoted strings.
+func splitQuoted(s string, sep byte) []string {
+	parts := []string{}
+	quoted := false
+	escaped := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case !quoted && c == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func unquote(value string) (string, error) {
+	if !strings.HasPrefix(value, `"`) {
+		return value, nil
+	}
+	if len(value) < 2 || !strings.HasSuffix(value, `"`) {
+		return "", fmt.Errorf("unterminated quoted string: %s", value)
+	}
+	sb := strings.Builder{}
+	inner := value[1 : len(value)-1]
+	for i := 0; i < len(inner); i++ {
+		if inner[i] == '\\' && i+1 < len(inner) {
+			i++
+		}
+		sb.WriteByte(inner[i])
+	}
+	return sb.String(), nil
+}
+
+// ParseForwarded parses the values of one or more RFC 7239 Forwarded headers
+// into a list of elements, ordered from the client to the last proxy.
+func ParseForwarded(values []string) ([]ForwardedElement, error) {
+	elements := []ForwardedElement{}
+	for _, value := range values {
+		for _, rawElement := range splitQuoted(value, ',') {
+			rawElement = strings.TrimSpace(rawElement)
+			if rawElement == "" {
+				continue
+			}
+			element := ForwardedElement{}
+			for _, pair := range splitQuoted(rawElement, ';') {
+				pair = strings.TrimSpace(pair)
+				if pair == "" {
+					continue
+				}
+				i := strings.IndexByte(pair, '=')
+				if i <= 0 {
+					return nil, fmt.Errorf("invalid Forwarded pair '%s'", pair)
+				}
+				v, err := unquote(strings.TrimSpace(pair[i+1:]))
+				if err != nil {
+					return nil, fmt.Errorf("invalid Forwarded pair '%s': %w", pair, err)
+				}
+				switch strings.ToLower(strings.TrimSpace(pair[:i])) {
+				case "for":
+					element.For = v
+				case "by":
+					element.By = v
+				case "host":
+					element.Host = v
+				case "proto":
+					element.Proto = strings.ToLower(v)
+				}
+			}
+			elements = append(elements, element)
+		}
+	}
+	return elements, nil
+}
+
+// clientElement walks the elements from the right, skipping trusted proxies,
+// and returns the element which has been added by the proxy that received the request from the client.
+func (t TrustedProxies) clientElement(elements []ForwardedElement) (ForwardedElement, bool) {
+	for i := len(elements) - 1; i >= 0; i-- {
+		ip := elements[i].IP()
+		if ip == nil || !t.Contains(ip) || i == 0 {
+			return elements[i], true
+		}
+	}
+	return ForwardedElement{}, false
+}
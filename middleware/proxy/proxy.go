@@ -3,12 +3,17 @@ package proxy
 import (
 	"net/http"
 	"strings"
+
+	"github.com/dusted-go/http/v6/middleware/mware"
 )
 
 const https = "https"
 
 // GetRealIP will take the first value which can be found in any of
 // the given headers and then set the request's RemoteAddr with it.
+//
+// Deprecated: The headers are trusted blindly, which lets clients spoof their IP address.
+// Use TrustedProxies.GetRealIP instead.
 func GetRealIP(headersToCheck ...string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(
@@ -31,6 +36,9 @@ func GetRealIP(headersToCheck ...string) func(http.Handler) http.Handler {
 //
 // Set the proxyCount to the number of known proxies so that any values
 // set by the origin caller get ignored.
+//
+// Deprecated: A wrong proxyCount lets clients spoof their IP address.
+// Use TrustedProxies.ForwardedHeaders instead.
 func ForwardedHeaders(proxyCount int) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(
@@ -39,7 +47,7 @@ func ForwardedHeaders(proxyCount int) func(http.Handler) http.Handler {
 				// Populate the URL object for later handlers
 				r.URL.Scheme = "http"
 				r.URL.Host = r.Host
-				if r.TLS != nil && strings.HasPrefix(r.Proto, "HTTP") {
+				if r.TLS != nil && mware.IsHTTP(r) {
 					r.URL.Scheme = https
 				}
 
@@ -0,0 +1,443 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func areEqual[T comparable](t *testing.T, expected, actual T) {
+	if expected != actual {
+		t.Errorf("Expected: %v, Actual: %v", expected, actual)
+	}
+}
+
+func Test_ParseForwarded(t *testing.T) {
+	elements, err := ParseForwarded([]string{
+		`for=192.0.2.60;proto=HTTPS;by=203.0.113.43;host="example.org"`,
+		`for="[2001:db8:cafe::17]:4711", for=_hidden;by="_a;b,c"`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	areEqual(t, 3, len(elements))
+	areEqual(t, "192.0.2.60", elements[0].For)
+	areEqual(t, "https", elements[0].Proto)
+	areEqual(t, "example.org", elements[0].Host)
+	areEqual(t, "203.0.113.43", elements[0].By)
+	areEqual(t, "2001:db8:cafe::17", elements[1].IP().String())
+	areEqual(t, true, elements[2].IP() == nil)
+	areEqual(t, "_a;b,c", elements[2].By)
+}
+
+func Test_ParseForwarded_Invalid(t *testing.T) {
+	if _, err := ParseForwarded([]string{`for="192.0.2.60`}); err == nil {
+		t.Error("Expected an error for an unterminated quoted string")
+	}
+}
+
+func serveForwarded(t *testing.T, remoteAddr string, headers map[string]string) *http.Request {
+	return serveForwardedFrom(t, XForwardedHeaders, remoteAddr, headers)
+}
+
+func serveForwardedFrom(t *testing.T, source HeaderSource, remoteAddr string, headers map[string]string) *http.Request {
+	trusted, err := ParseTrustedProxies("10.0.0.0/8", "192.168.1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result *http.Request
+	handler := trusted.ForwardedHeaders(source)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			result = r
+		}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = remoteAddr
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	return result
+}
+
+func Test_ForwardedHeaders_UntrustedPeer(t *testing.T) {
+	r := serveForwarded(t, "203.0.113.5:1234", map[string]string{
+		"X-Forwarded-For":   "1.2.3.4",
+		"X-Forwarded-Proto": "https",
+	})
+	areEqual(t, "203.0.113.5:1234", r.RemoteAddr)
+	areEqual(t, "http", r.URL.Scheme)
+	areEqual(t, "203.0.113.5:1234", PeerAddr(r.Context()))
+}
+
+func Test_ForwardedHeaders_SkipsTrustedHops(t *testing.T) {
+	r := serveForwarded(t, "10.0.0.2:1234", map[string]string{
+		"X-Forwarded-For":   "6.6.6.6, 198.51.100.7, 192.168.1.1, 10.1.1.1",
+		"X-Forwarded-Proto": "https",
+		"X-Forwarded-Host":  "example.org",
+		"X-Forwarded-Port":  "8443",
+	})
+	areEqual(t, "198.51.100.7", r.RemoteAddr)
+	areEqual(t, "https", r.URL.Scheme)
+	areEqual(t, "example.org:8443", r.Host)
+	areEqual(t, "example.org:8443", r.URL.Host)
+	areEqual(t, "10.0.0.2:1234", PeerAddr(r.Context()))
+}
+
+func Test_ForwardedHeaders_Forwarded(t *testing.T) {
+	r := serveForwardedFrom(t, ForwardedHeader, "10.0.0.2:1234", map[string]string{
+		"Forwarded": `for=6.6.6.6, for="[2001:db8::1]:4711";proto=https;host=example.org, for=10.0.0.9`,
+	})
+	areEqual(t, "2001:db8::1", r.RemoteAddr)
+	areEqual(t, "https", r.URL.Scheme)
+	areEqual(t, "example.org", r.Host)
+}
+
+func Test_ForwardedHeaders_IgnoresSpoofedForwardedHeader(t *testing.T) {
+	// The trusted proxy only appends to X-Forwarded-For and passes the client's Forwarded header on:
+	r := serveForwardedFrom(t, XForwardedHeaders, "10.0.0.2:1234", map[string]string{
+		"Forwarded":       "for=1.2.3.4;host=evil.example;proto=https",
+		"X-Forwarded-For": "198.51.100.7",
+	})
+	areEqual(t, "198.51.100.7", r.RemoteAddr)
+	areEqual(t, "http", r.URL.Scheme)
+	areEqual(t, "example.com", r.Host)
+}
+
+func Test_ForwardedHeaders_IgnoresSpoofedXForwardedHeaders(t *testing.T) {
+	r := serveForwardedFrom(t, ForwardedHeader, "10.0.0.2:1234", map[string]string{
+		"X-Forwarded-For":   "1.2.3.4",
+		"X-Forwarded-Host":  "evil.example",
+		"X-Forwarded-Proto": "https",
+	})
+	areEqual(t, "10.0.0.2:1234", r.RemoteAddr)
+	areEqual(t, "http", r.URL.Scheme)
+	areEqual(t, "example.com", r.Host)
+}
+
+func Test_ForwardedHeaders_UsesHostAndProtoOfNearestProxy(t *testing.T) {
+	// The client sent the leftmost values, the trusted proxy appended its own:
+	r := serveForwarded(t, "10.0.0.2:1234", map[string]string{
+		"X-Forwarded-For":   "1.2.3.4, 198.51.100.7",
+		"X-Forwarded-Host":  "evil.example, example.org",
+		"X-Forwarded-Proto": "https, http",
+	})
+	areEqual(t, "198.51.100.7", r.RemoteAddr)
+	areEqual(t, "http", r.URL.Scheme)
+	areEqual(t, "example.org", r.Host)
+}
+
+// newUpstream starts a server which responds with its name and records the last request.
+func newUpstream(t *testing.T, name string, last **http.Request) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if last != nil {
+			*last = r
+		}
+		_, _ = io.WriteString(w, name)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// closedURL returns the URL of a server which isn't accepting connections anymore.
+func closedURL() string {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	return server.URL
+}
+
+func proxyRequest(t *testing.T, handler http.Handler, method, target, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	req.RemoteAddr = remoteAddr
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func Test_ReverseProxy_ForwardedHeaders(t *testing.T) {
+	var last *http.Request
+	upstream := newUpstream(t, "a", &last)
+	p, err := NewReverseProxy([]string{upstream.URL}, RoundRobin(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trusted, err := ParseTrustedProxies("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := trusted.ForwardedHeaders(XForwardedHeaders)(p)
+
+	testCases := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		expected   string
+	}{
+		{"untrusted peer", "198.51.100.7:1234", "1.2.3.4", "198.51.100.7"},
+		{"trusted peer", "10.0.0.2:1234", "1.2.3.4, 198.51.100.7", "198.51.100.7"},
+		{"without header", "10.0.0.2:1234", "", "10.0.0.2"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			req.RemoteAddr = tc.remoteAddr
+			if tc.xff != "" {
+				req.Header.Set("X-Forwarded-For", tc.xff)
+			}
+			req.Header.Set("Forwarded", "for=1.2.3.4")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			areEqual(t, http.StatusOK, w.Code)
+			areEqual(t, tc.expected, last.Header.Get("X-Forwarded-For"))
+			areEqual(t, "http", last.Header.Get("X-Forwarded-Proto"))
+			areEqual(t, "example.com", last.Header.Get("X-Forwarded-Host"))
+			areEqual(t, "", last.Header.Get("Forwarded"))
+		})
+	}
+}
+
+func Test_ReverseProxy_JoinsQuery(t *testing.T) {
+	var last *http.Request
+	upstream := newUpstream(t, "a", &last)
+
+	testCases := []struct {
+		upstreamQuery string
+		target        string
+		expected      string
+	}{
+		{"", "/api/items", ""},
+		{"", "/api/items?page=2", "page=2"},
+		{"?key=1", "/api/items", "key=1"},
+		{"?key=1", "/api/items?page=2", "key=1&page=2"},
+	}
+	for _, tc := range testCases {
+		p, err := NewReverseProxy([]string{upstream.URL + "/v1" + tc.upstreamQuery}, RoundRobin(), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := proxyRequest(t, p, http.MethodGet, tc.target, "198.51.100.7:1234")
+		areEqual(t, http.StatusOK, w.Code)
+		areEqual(t, "/v1/api/items", last.URL.Path)
+		areEqual(t, tc.expected, last.URL.RawQuery)
+	}
+}
+
+func Test_ReverseProxy_RoundRobin(t *testing.T) {
+	a := newUpstream(t, "a", nil)
+	b := newUpstream(t, "b", nil)
+	p, err := NewReverseProxy([]string{a.URL, b.URL}, RoundRobin(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"a", "b", "a", "b"} {
+		w := proxyRequest(t, p, http.MethodGet, "/", "198.51.100.7:1234")
+		areEqual(t, expected, w.Body.String())
+	}
+}
+
+func Test_ReverseProxy_Failover(t *testing.T) {
+	a := newUpstream(t, "a", nil)
+	p, err := NewReverseProxy([]string{closedURL(), a.URL}, RoundRobin(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Idempotent requests are retried on the next upstream:
+	w := proxyRequest(t, p, http.MethodGet, "/", "198.51.100.7:1234")
+	areEqual(t, http.StatusOK, w.Code)
+	areEqual(t, "a", w.Body.String())
+	w = proxyRequest(t, p, http.MethodGet, "/", "198.51.100.7:1234")
+	areEqual(t, "a", w.Body.String())
+
+	// Other requests are not:
+	w = proxyRequest(t, p, http.MethodPost, "/", "198.51.100.7:1234")
+	areEqual(t, http.StatusBadGateway, w.Code)
+	areEqual(t, int64(0), p.Upstreams()[0].ActiveRequests())
+	areEqual(t, int64(0), p.Upstreams()[1].ActiveRequests())
+}
+
+func Test_ReverseProxy_Upgrade(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		_ = rw.Flush()
+		_, _ = io.Copy(conn, rw)
+	}))
+	defer upstream.Close()
+	p, err := NewReverseProxy([]string{upstream.URL}, RoundRobin(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(p)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, _ = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected: %d, Actual: %d", http.StatusSwitchingProtocols, resp.StatusCode)
+	}
+	areEqual(t, int64(1), p.Upstreams()[0].ActiveRequests())
+
+	_, _ = io.WriteString(conn, "ping")
+	echo := make([]byte, 4)
+	if _, err := io.ReadFull(reader, echo); err != nil {
+		t.Fatal(err)
+	}
+	areEqual(t, "ping", string(echo))
+
+	// Closing the upgraded connection must end the active request:
+	_ = conn.Close()
+	deadline := time.Now().Add(time.Second)
+	for p.Upstreams()[0].ActiveRequests() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	areEqual(t, int64(0), p.Upstreams()[0].ActiveRequests())
+}
+
+func Test_ReverseProxy_HealthChecks(t *testing.T) {
+	a := newUpstream(t, "a", nil)
+	unhealthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer unhealthy.Close()
+
+	p, err := NewReverseProxy([]string{unhealthy.URL, a.URL}, RoundRobin(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	areEqual(t, true, p.StartHealthChecks(ctx, "/healthz", 0, time.Second) != nil)
+	areEqual(t, true, p.StartHealthChecks(ctx, "/healthz", time.Hour, 0) != nil)
+	if err := p.StartHealthChecks(ctx, "/healthz", time.Hour, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for p.Upstreams()[0].Healthy() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	areEqual(t, false, p.Upstreams()[0].Healthy())
+	areEqual(t, true, p.Upstreams()[1].Healthy())
+	for i := 0; i < 3; i++ {
+		w := proxyRequest(t, p, http.MethodGet, "/", "198.51.100.7:1234")
+		areEqual(t, "a", w.Body.String())
+	}
+
+	// Without healthy upstreams the proxy is unavailable:
+	p.Upstreams()[1].setHealthy(false)
+	w := proxyRequest(t, p, http.MethodGet, "/", "198.51.100.7:1234")
+	areEqual(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func Test_Listener_ProxyProtocol(t *testing.T) {
+	trusted, err := ParseTrustedProxies("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewListener(inner, trusted, time.Second)
+	defer l.Close()
+
+	v2 := append([]byte{}, proxyV2Signature...)
+	v2 = append(v2, 0x21, 0x11, 0x00, 0x0c)
+	v2 = append(v2, 198, 51, 100, 7, 192, 0, 2, 1, 0x1f, 0x90, 0x01, 0xbb)
+
+	for _, tc := range []struct {
+		header   []byte
+		expected string
+	}{
+		{[]byte("PROXY TCP4 203.0.113.9 192.0.2.1 56324 443\r\n"), "203.0.113.9:56324"},
+		{[]byte("PROXY TCP6 2001:db8::1 2001:db8::2 4711 443\r\n"), "[2001:db8::1]:4711"},
+		{v2, "198.51.100.7:8080"},
+	} {
+		client, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = client.Write(append(tc.header, []byte("hello")...))
+
+		conn, err := l.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		areEqual(t, tc.expected, conn.RemoteAddr().String())
+		body := make([]byte, 5)
+		if _, err := io.ReadFull(conn, body); err != nil {
+			t.Fatal(err)
+		}
+		areEqual(t, "hello", string(body))
+		_ = conn.Close()
+		_ = client.Close()
+	}
+}
+
+func Test_Listener_ProxyProtocolTimeout(t *testing.T) {
+	trusted, err := ParseTrustedProxies("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewListener(inner, trusted, 50*time.Millisecond)
+	defer l.Close()
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// A trusted proxy which doesn't send a header in time must be disconnected:
+	areEqual(t, client.LocalAddr().String(), conn.RemoteAddr().String())
+	_, _ = client.Write([]byte("hello"))
+	_, err = conn.Read(make([]byte, 5))
+	areEqual(t, true, err != nil)
+	_ = client.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = client.Read(make([]byte, 1))
+	areEqual(t, true, errors.Is(err, io.EOF))
+}
+
+func Test_ParseProxyV1_Invalid(t *testing.T) {
+	for _, line := range []string{
+		"PROXY TCP4 203.0.113.9 192.0.2.1 56324\r\n",
+		"PROXY TCP4 2001:db8::1 192.0.2.1 56324 443\r\n",
+		"PROXY TCP4 203.0.113.9 192.0.2.1 56324 443\n",
+		"PROXY UDP4 203.0.113.9 192.0.2.1 56324 443\r\n",
+	} {
+		if _, _, err := parseProxyV1(line); err == nil {
+			t.Errorf("Expected an error for %q", line)
+		}
+	}
+}
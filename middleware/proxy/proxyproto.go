@@ -0,0 +1,253 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	proxyV1Prefix    = []byte("PROXY ")
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+const (
+	proxyV1MaxLength    = 107
+	proxyV2HeaderLength = 16
+)
+
+// Listener wraps a net.Listener and parses the HAProxy PROXY protocol (v1 and v2)
+// header of connections from trusted proxies.
+//
+// Accepted connections report the original source and destination
+// addresses from the header via RemoteAddr and LocalAddr.
+type Listener struct {
+	net.Listener
+	trusted       TrustedProxies
+	headerTimeout time.Duration
+}
+
+// NewListener wraps the given listener. Headers are only parsed on connections from
+// trusted proxies and must arrive within the headerTimeout.
+func NewListener(
+	inner net.Listener,
+	trusted TrustedProxies,
+	headerTimeout time.Duration,
+) *Listener {
+	return &Listener{
+		Listener:      inner,
+		trusted:       trusted,
+		headerTimeout: headerTimeout,
+	}
+}
+
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		// nolint: wrapcheck // Must behave like the wrapped listener
+		return nil, err
+	}
+	if !l.trusted.Contains(parseIP(conn.RemoteAddr().String())) {
+		return conn, nil
+	}
+	return &proxyConn{
+		Conn:          conn,
+		reader:        bufio.NewReader(conn),
+		headerTimeout: l.headerTimeout,
+	}, nil
+}
+
+// proxyConn parses the PROXY header lazily, so that a slow client doesn't block the Accept loop.
+type proxyConn struct {
+	net.Conn
+	reader        *bufio.Reader
+	headerTimeout time.Duration
+
+	once       sync.Once
+	err        error
+	remoteAddr net.Addr
+	localAddr  net.Addr
+}
+
+func (c *proxyConn) init() {
+	c.once.Do(func() {
+		if c.headerTimeout > 0 {
+			_ = c.Conn.SetReadDeadline(time.Now().Add(c.headerTimeout))
+			defer func() { _ = c.Conn.SetReadDeadline(time.Time{}) }()
+		}
+		c.remoteAddr, c.localAddr, c.err = readProxyHeader(c.reader)
+		if c.err != nil {
+			_ = c.Conn.Close()
+		}
+	})
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	// nolint: wrapcheck // Must behave like the wrapped connection
+	return c.reader.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.init()
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyConn) LocalAddr() net.Addr {
+	c.init()
+	if c.localAddr != nil {
+		return c.localAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+// readProxyHeader reads a PROXY header if there is one.
+// It returns nil addresses if there is no header or if the addresses are unknown
+// and an error if the header could not be read (e.g. within the header timeout).
+func readProxyHeader(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	prefix, err := r.Peek(len(proxyV1Prefix))
+	if errors.Is(err, io.EOF) {
+		// Connections which end before a header could be sent don't carry one:
+		return nil, nil, nil
+	}
+	if err != nil {
+		// This includes proxies which didn't send anything within the header timeout:
+		return nil, nil, fmt.Errorf("error reading PROXY header: %w", err)
+	}
+	if bytes.Equal(prefix, proxyV1Prefix) {
+		return readProxyV1(r)
+	}
+	if bytes.Equal(prefix, proxyV2Signature[:len(proxyV1Prefix)]) {
+		signature, err := r.Peek(len(proxyV2Signature))
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, nil, fmt.Errorf("error reading PROXY v2 signature: %w", err)
+		}
+		if bytes.Equal(signature, proxyV2Signature) {
+			return readProxyV2(r)
+		}
+	}
+	return nil, nil, nil
+}
+
+func readProxyV1(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	line := make([]byte, 0, proxyV1MaxLength)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading PROXY v1 header: %w", err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= proxyV1MaxLength {
+			return nil, nil, errors.New("PROXY v1 header is too long")
+		}
+	}
+	return parseProxyV1(string(line))
+}
+
+// parseProxyV1 parses a line such as "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n".
+func parseProxyV1(line string) (net.Addr, net.Addr, error) {
+	if !strings.HasSuffix(line, "\r\n") {
+		return nil, nil, errors.New("PROXY v1 header must end with CRLF")
+	}
+	fields := strings.Split(strings.TrimSuffix(line, "\r\n"), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 {
+		return nil, nil, fmt.Errorf("invalid PROXY v1 header: %q", line)
+	}
+	if fields[1] != "TCP4" && fields[1] != "TCP6" {
+		return nil, nil, fmt.Errorf("unsupported PROXY v1 protocol: %s", fields[1])
+	}
+
+	parse := func(ip, port string) (*net.TCPAddr, error) {
+		parsedIP := net.ParseIP(ip)
+		if parsedIP == nil || (fields[1] == "TCP4") != (parsedIP.To4() != nil) {
+			return nil, fmt.Errorf("invalid PROXY v1 address: %s", ip)
+		}
+		parsedPort, err := strconv.ParseUint(port, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PROXY v1 port: %s", port)
+		}
+		return &net.TCPAddr{IP: parsedIP, Port: int(parsedPort)}, nil
+	}
+
+	src, err := parse(fields[2], fields[4])
+	if err != nil {
+		return nil, nil, err
+	}
+	dst, err := parse(fields[3], fields[5])
+	if err != nil {
+		return nil, nil, err
+	}
+	return src, dst, nil
+}
+
+func readProxyV2(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	header := make([]byte, proxyV2HeaderLength)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, fmt.Errorf("error reading PROXY v2 header: %w", err)
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, nil, fmt.Errorf("error reading PROXY v2 addresses: %w", err)
+	}
+	return parseProxyV2(header, payload)
+}
+
+// parseProxyV2 parses the 16 byte header and the address payload of a PROXY v2 header.
+func parseProxyV2(header, payload []byte) (net.Addr, net.Addr, error) {
+	if header[12]>>4 != 2 {
+		return nil, nil, fmt.Errorf("unsupported PROXY protocol version: %d", header[12]>>4)
+	}
+	switch header[12] & 0x0f {
+	case 0x0:
+		// LOCAL command (e.g. health checks of the proxy itself):
+		return nil, nil, nil
+	case 0x1:
+		// PROXY command
+	default:
+		return nil, nil, fmt.Errorf("unsupported PROXY v2 command: %d", header[12]&0x0f)
+	}
+
+	var ipLength int
+	switch header[13] >> 4 {
+	case 0x1:
+		ipLength = net.IPv4len
+	case 0x2:
+		ipLength = net.IPv6len
+	default:
+		// AF_UNSPEC and AF_UNIX addresses are not useful as a RemoteAddr:
+		return nil, nil, nil
+	}
+	if len(payload) < 2*ipLength+4 {
+		return nil, nil, errors.New("PROXY v2 address block is too short")
+	}
+
+	srcIP := net.IP(payload[:ipLength])
+	dstIP := net.IP(payload[ipLength : 2*ipLength])
+	srcPort := int(binary.BigEndian.Uint16(payload[2*ipLength:]))
+	dstPort := int(binary.BigEndian.Uint16(payload[2*ipLength+2:]))
+
+	if header[13]&0x0f == 0x2 {
+		return &net.UDPAddr{IP: srcIP, Port: srcPort}, &net.UDPAddr{IP: dstIP, Port: dstPort}, nil
+	}
+	return &net.TCPAddr{IP: srcIP, Port: srcPort}, &net.TCPAddr{IP: dstIP, Port: dstPort}, nil
+}
@@ -0,0 +1,333 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var errNoUpstream = errors.New("no healthy upstream available")
+
+// Upstream is a backend server of a ReverseProxy.
+type Upstream struct {
+	URL *url.URL
+
+	healthy int32
+	active  int64
+}
+
+// Healthy returns false if the last active health check failed.
+func (u *Upstream) Healthy() bool {
+	return atomic.LoadInt32(&u.healthy) == 1
+}
+
+func (u *Upstream) setHealthy(healthy bool) {
+	var v int32
+	if healthy {
+		v = 1
+	}
+	atomic.StoreInt32(&u.healthy, v)
+}
+
+// ActiveRequests returns the number of requests which are currently proxied to the upstream.
+func (u *Upstream) ActiveRequests() int64 {
+	return atomic.LoadInt64(&u.active)
+}
+
+// ReverseProxy forwards requests to a set of upstreams, balancing the load between them.
+type ReverseProxy struct {
+	upstreams []*Upstream
+	balancer  Balancer
+	retries   int
+	transport http.RoundTripper
+	proxy     *httputil.ReverseProxy
+}
+
+// NewReverseProxy creates a reverse proxy for the given upstream URLs (e.g. http://10.0.0.5:8080).
+//
+// Failed idempotent requests are retried up to the given number of times on other upstreams.
+// All upstreams are considered healthy until the first active health check (see StartHealthChecks).
+func NewReverseProxy(
+	targets []string,
+	balancer Balancer,
+	retries int,
+) (*ReverseProxy, error) {
+	if len(targets) == 0 {
+		return nil, errors.New("at least one upstream is required")
+	}
+	upstreams := make([]*Upstream, 0, len(targets))
+	for _, target := range targets {
+		u, err := url.Parse(target)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing upstream URL '%s': %w", target, err)
+		}
+		if u.Scheme != "http" && u.Scheme != https {
+			return nil, fmt.Errorf("upstream URL '%s' must use http or https", target)
+		}
+		upstream := &Upstream{URL: u}
+		upstream.setHealthy(true)
+		upstreams = append(upstreams, upstream)
+	}
+
+	p := &ReverseProxy{
+		upstreams: upstreams,
+		balancer:  balancer,
+		retries:   retries,
+		transport: http.DefaultTransport,
+	}
+	p.proxy = &httputil.ReverseProxy{
+		Director:     setForwardedHeaders,
+		Transport:    roundTripperFunc(p.roundTrip),
+		ErrorHandler: handleProxyError,
+	}
+	return p, nil
+}
+
+// Upstreams returns all upstreams of the proxy.
+func (p *ReverseProxy) Upstreams() []*Upstream {
+	return p.upstreams
+}
+
+// SetTransport replaces the http.DefaultTransport which is used to send requests to the upstreams.
+func (p *ReverseProxy) SetTransport(transport http.RoundTripper) *ReverseProxy {
+	p.transport = transport
+	return p
+}
+
+func (p *ReverseProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.proxy.ServeHTTP(w, r)
+}
+
+// setForwardedHeaders sets the X-Forwarded-Proto and X-Forwarded-Host headers
+// in the same way as they get parsed by TrustedProxies.ForwardedHeaders.
+// X-Forwarded-For is set by setForwardedFor.
+func setForwardedHeaders(r *http.Request) {
+	scheme := "http"
+	if r.TLS != nil || r.URL.Scheme == https {
+		scheme = https
+	}
+	// A nil value stops httputil.ReverseProxy from appending to the header:
+	r.Header["X-Forwarded-For"] = nil
+	r.Header.Set("X-Forwarded-Proto", scheme)
+	r.Header.Set("X-Forwarded-Host", r.Host)
+	r.Header.Del("X-Forwarded-Port")
+	r.Header.Del("Forwarded")
+}
+
+// setForwardedFor replaces X-Forwarded-For with the client IP.
+//
+// httputil.ReverseProxy would leave the client's header untouched if the RemoteAddr has no port,
+// which is the case after TrustedProxies.ForwardedHeaders replaced it with the client IP.
+// The addresses in the client's header have either been resolved by then or can't be trusted.
+func setForwardedFor(r *http.Request) {
+	if ip := parseIP(r.RemoteAddr); ip != nil {
+		r.Header.Set("X-Forwarded-For", ip.String())
+		return
+	}
+	r.Header.Del("X-Forwarded-For")
+}
+
+func handleProxyError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errNoUpstream) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, context.Canceled) {
+		// The client went away, there is nobody to respond to:
+		return
+	}
+	w.WriteHeader(http.StatusBadGateway)
+}
+
+type roundTripperFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func isIdempotent(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return r.Body == nil || r.Body == http.NoBody || r.GetBody != nil
+	default:
+		return false
+	}
+}
+
+func joinPath(a, b string) string {
+	switch {
+	case a == "":
+		return b
+	case strings.HasSuffix(a, "/") && strings.HasPrefix(b, "/"):
+		return a + b[1:]
+	case !strings.HasSuffix(a, "/") && !strings.HasPrefix(b, "/"):
+		return a + "/" + b
+	default:
+		return a + b
+	}
+}
+
+func joinQuery(a, b string) string {
+	if a == "" || b == "" {
+		return a + b
+	}
+	return a + "&" + b
+}
+
+// candidates returns all healthy upstreams which haven't been tried yet.
+func (p *ReverseProxy) candidates(tried map[*Upstream]bool) []*Upstream {
+	candidates := make([]*Upstream, 0, len(p.upstreams))
+	for _, u := range p.upstreams {
+		if u.Healthy() && !tried[u] {
+			candidates = append(candidates, u)
+		}
+	}
+	return candidates
+}
+
+func (p *ReverseProxy) roundTrip(r *http.Request) (*http.Response, error) {
+	tried := map[*Upstream]bool{}
+	var lastErr error = errNoUpstream
+
+	for attempt := 0; attempt <= p.retries; attempt++ {
+		candidates := p.candidates(tried)
+		if len(candidates) == 0 {
+			break
+		}
+		upstream := p.balancer.Next(r, candidates)
+		tried[upstream] = true
+
+		out := r.Clone(r.Context())
+		if attempt > 0 && r.GetBody != nil {
+			body, err := r.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("error rewinding request body: %w", err)
+			}
+			out.Body = body
+		}
+		out.URL.Scheme = upstream.URL.Scheme
+		out.URL.Host = upstream.URL.Host
+		out.URL.Path = joinPath(upstream.URL.Path, r.URL.Path)
+		out.URL.RawPath = ""
+		out.URL.RawQuery = joinQuery(upstream.URL.RawQuery, r.URL.RawQuery)
+		setForwardedFor(out)
+
+		atomic.AddInt64(&upstream.active, 1)
+		resp, err := p.transport.RoundTrip(out)
+		if err == nil {
+			resp.Body = trackBody(resp, upstream)
+			return resp, nil
+		}
+		atomic.AddInt64(&upstream.active, -1)
+
+		lastErr = fmt.Errorf("error proxying request to %s: %w", upstream.URL.Host, err)
+		if !isIdempotent(r) || r.Context().Err() != nil {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// trackedBody decrements the active requests of an upstream once the response has been consumed.
+type trackedBody struct {
+	io.ReadCloser
+	upstream *Upstream
+	once     sync.Once
+}
+
+func (b *trackedBody) Close() error {
+	b.once.Do(func() {
+		atomic.AddInt64(&b.upstream.active, -1)
+	})
+	// nolint: wrapcheck // Must behave like the wrapped body
+	return b.ReadCloser.Close()
+}
+
+// trackedConn is the body of a 101 Switching Protocols response, which httputil
+// needs to be writable. The upgraded connection counts as active until it is closed.
+type trackedConn struct {
+	*trackedBody
+	io.Writer
+}
+
+func trackBody(resp *http.Response, upstream *Upstream) io.ReadCloser {
+	body := &trackedBody{ReadCloser: resp.Body, upstream: upstream}
+	if conn, ok := resp.Body.(io.ReadWriteCloser); ok && resp.StatusCode == http.StatusSwitchingProtocols {
+		return &trackedConn{trackedBody: body, Writer: conn}
+	}
+	return body
+}
+
+// StartHealthChecks sends a GET request to the given path of every upstream in the given interval
+// and marks upstreams as unhealthy which don't respond with a 2xx or 3xx status code within the timeout.
+// The health checks stop when ctx is cancelled.
+//
+// It returns an error if the interval or the timeout is not positive.
+func (p *ReverseProxy) StartHealthChecks(
+	ctx context.Context,
+	path string,
+	interval time.Duration,
+	timeout time.Duration,
+) error {
+	if interval <= 0 {
+		return fmt.Errorf("health check interval must be positive, but is %s", interval)
+	}
+	if timeout <= 0 {
+		return fmt.Errorf("health check timeout must be positive, but is %s", timeout)
+	}
+	client := &http.Client{
+		Transport: p.transport,
+		Timeout:   timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	check := func() {
+		wg := sync.WaitGroup{}
+		for _, u := range p.upstreams {
+			wg.Add(1)
+			go func(u *Upstream) {
+				defer wg.Done()
+				u.setHealthy(isHealthy(ctx, client, joinPath(u.URL.String(), path)))
+			}(u)
+		}
+		wg.Wait()
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		check()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				check()
+			}
+		}
+	}()
+	return nil
+}
+
+func isHealthy(ctx context.Context, client *http.Client, target string) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode >= 200 && resp.StatusCode < 400
+}
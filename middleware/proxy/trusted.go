@@ -0,0 +1,281 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/dusted-go/http/v6/middleware/mware"
+)
+
+type peerKey struct{}
+
+// TrustedProxies is a list of networks which are known to
+// be proxies and whose forwarding headers can be trusted.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies parses a list of CIDRs (e.g. 10.0.0.0/8) or single IP addresses.
+func ParseTrustedProxies(cidrs ...string) (TrustedProxies, error) {
+	trusted := make(TrustedProxies, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy IP address '%s'", cidr)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			trusted = append(trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy network '%s': %w", cidr, err)
+		}
+		trusted = append(trusted, network)
+	}
+	return trusted, nil
+}
+
+// Contains returns true if the IP address belongs to a trusted proxy.
+func (t TrustedProxies) Contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range t {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIP parses an address with or without a port.
+func parseIP(addr string) net.IP {
+	addr = strings.TrimSpace(addr)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	return net.ParseIP(strings.Trim(addr, "[]"))
+}
+
+// PeerAddr returns the address of the immediate peer which sent the request,
+// before it got replaced by a client address from a forwarding header.
+// It returns an empty string if none of the trusted middlewares ran.
+func PeerAddr(ctx context.Context) string {
+	if addr, ok := ctx.Value(peerKey{}).(string); ok {
+		return addr
+	}
+	return ""
+}
+
+func withPeerAddr(r *http.Request) *http.Request {
+	if PeerAddr(r.Context()) != "" {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), peerKey{}, r.RemoteAddr))
+}
+
+// isTrustedPeer returns true if the request has been sent by a trusted proxy.
+func (t TrustedProxies) isTrustedPeer(r *http.Request) bool {
+	return t.Contains(parseIP(PeerAddr(r.Context())))
+}
+
+// clientIP walks a list of forwarded addresses from the right, skipping trusted proxies,
+// and returns the first address which doesn't belong to a trusted proxy.
+func (t TrustedProxies) clientIP(addrs []string) string {
+	for i := len(addrs) - 1; i >= 0; i-- {
+		ip := parseIP(addrs[i])
+		if ip == nil {
+			// Anything left of an invalid entry cannot be trusted:
+			if i < len(addrs)-1 {
+				return parseIP(addrs[i+1]).String()
+			}
+			return ""
+		}
+		if !t.Contains(ip) || i == 0 {
+			return ip.String()
+		}
+	}
+	return ""
+}
+
+func splitList(values []string) []string {
+	items := []string{}
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// GetRealIP sets the request's RemoteAddr to the client address from the first of the given headers
+// which is set, but only if the request came from a trusted proxy.
+//
+// Headers with a list of addresses (e.g. X-Forwarded-For) are walked from the right,
+// skipping all trusted proxies.
+func (t TrustedProxies) GetRealIP(headersToCheck ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				r = withPeerAddr(r)
+				if !t.isTrustedPeer(r) {
+					next.ServeHTTP(w, r)
+					return
+				}
+				for _, headerName := range headersToCheck {
+					addrs := splitList(r.Header.Values(headerName))
+					if len(addrs) == 0 {
+						continue
+					}
+					if ip := t.clientIP(addrs); ip != "" {
+						r.RemoteAddr = ip
+					}
+					break
+				}
+				next.ServeHTTP(w, r)
+			},
+		)
+	}
+}
+
+// lastValue returns the last entry of a header which might contain a list,
+// which has been added by the nearest proxy. Entries further left can be
+// written by the client and must not be trusted.
+func lastValue(h http.Header, name string) string {
+	items := splitList(h.Values(name))
+	if len(items) == 0 {
+		return ""
+	}
+	return items[len(items)-1]
+}
+
+// stripPort removes the port from a host if it has one.
+func stripPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		if strings.Contains(h, ":") {
+			return "[" + h + "]"
+		}
+		return h
+	}
+	return host
+}
+
+// withPort appends the port to a host unless it has a port already or the port is the scheme's default.
+func withPort(host, port, scheme string) string {
+	if host == "" || port == "" {
+		return host
+	}
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	if (scheme == https && port == "443") || (scheme == "http" && port == "80") {
+		return host
+	}
+	if strings.Contains(host, ":") && !strings.HasPrefix(host, "[") {
+		host = "[" + host + "]"
+	}
+	return host + ":" + port
+}
+
+// HeaderSource selects the forwarding headers which are set by the trusted proxies.
+type HeaderSource int
+
+const (
+	// XForwardedHeaders are the X-Forwarded-For, X-Forwarded-Proto, X-Forwarded-Host
+	// and X-Forwarded-Port headers.
+	XForwardedHeaders HeaderSource = iota
+
+	// ForwardedHeader is the RFC 7239 Forwarded header.
+	ForwardedHeader
+)
+
+// ForwardedHeaders parses the forwarding headers of the given source and modifies the
+// request object accordingly, but only if the request came from a trusted proxy.
+// Headers of the other source are ignored, because the proxies don't overwrite them
+// and they can therefore contain anything the client sent.
+//
+// The client is found by walking the list of hops from the right, skipping all trusted proxies.
+// The address of the immediate peer remains available via PeerAddr.
+//
+// For the Forwarded header the host and protocol are taken from the same hop as the client address.
+// For the X-Forwarded headers they are taken from the rightmost entry, which has been
+// added by the nearest proxy.
+//
+// The RemoteAddr is left unchanged if the client's node identifier in the Forwarded header
+// is unknown or obfuscated.
+func (t TrustedProxies) ForwardedHeaders(source HeaderSource) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				r = withPeerAddr(r)
+
+				// Populate the URL object for later handlers
+				r.URL.Scheme = "http"
+				r.URL.Host = r.Host
+				if r.TLS != nil && mware.IsHTTP(r) {
+					r.URL.Scheme = https
+				}
+
+				// Ignore forwarding headers from untrusted peers
+				if !t.isTrustedPeer(r) {
+					next.ServeHTTP(w, r)
+					return
+				}
+
+				var clientIP, proto, host string
+				switch source {
+				case ForwardedHeader:
+					elements, err := ParseForwarded(r.Header.Values("Forwarded"))
+					if err != nil {
+						next.ServeHTTP(w, r)
+						return
+					}
+					if element, ok := t.clientElement(elements); ok {
+						if ip := element.IP(); ip != nil {
+							clientIP = ip.String()
+						}
+						proto = element.Proto
+						host = element.Host
+					}
+				default:
+					clientIP = t.clientIP(splitList(r.Header.Values("X-Forwarded-For")))
+					proto = strings.ToLower(lastValue(r.Header, "X-Forwarded-Proto"))
+					host = lastValue(r.Header, "X-Forwarded-Host")
+					if port := lastValue(r.Header, "X-Forwarded-Port"); port != "" {
+						if host == "" {
+							host = stripPort(r.Host)
+						}
+						scheme := r.URL.Scheme
+						if proto == https || proto == "http" {
+							scheme = proto
+						}
+						host = withPort(host, port, scheme)
+					}
+				}
+
+				if proto == https || proto == "http" {
+					r.URL.Scheme = proto
+				}
+				if host != "" {
+					r.Host = host
+					r.URL.Host = host
+				}
+				if clientIP != "" {
+					r.RemoteAddr = clientIP
+				}
+
+				next.ServeHTTP(w, r)
+			},
+		)
+	}
+}
@@ -0,0 +1,203 @@
+package recoverer
+
+import (
+	"bufio"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/dusted-go/http/v6/middleware/headers"
+)
+
+// excerptLines is the number of source lines shown before and after the line of a frame.
+const excerptLines = 5
+
+// SourceLine is a single line of a source code excerpt.
+type SourceLine struct {
+	Number  int    `json:"number"`
+	Code    string `json:"code"`
+	Current bool   `json:"current"`
+}
+
+// DebugFrame is a stack frame together with an excerpt of its source code.
+type DebugFrame struct {
+	Frame
+	Source []SourceLine `json:"source,omitempty"`
+}
+
+// DebugInfo is the content of the development error page.
+type DebugInfo struct {
+	Error      string              `json:"error"`
+	Method     string              `json:"method"`
+	URL        string              `json:"url"`
+	Path       string              `json:"path"`
+	RemoteAddr string              `json:"remoteAddr"`
+	RequestID  string              `json:"requestId,omitempty"`
+	Header     map[string][]string `json:"header"`
+	Form       map[string][]string `json:"form"`
+	Stack      []DebugFrame        `json:"stack"`
+}
+
+func sourceExcerpt(file string, line int) []SourceLine {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	excerpt := []SourceLine{}
+	scanner := bufio.NewScanner(f)
+	for number := 1; scanner.Scan(); number++ {
+		if number < line-excerptLines {
+			continue
+		}
+		if number > line+excerptLines {
+			break
+		}
+		excerpt = append(excerpt, SourceLine{
+			Number:  number,
+			Code:    scanner.Text(),
+			Current: number == line,
+		})
+	}
+	return excerpt
+}
+
+func formValues(r *http.Request, opts Options) map[string][]string {
+	// The body might have been consumed already, in which case only the query remains:
+	_ = r.ParseForm()
+	form := map[string][]string{}
+	for name, values := range r.Form {
+		lowerName := strings.ToLower(name)
+		if strings.Contains(lowerName, "password") ||
+			contains(DefaultRedactedQueryParams, name) ||
+			contains(opts.RedactedQueryParams, name) {
+			values = []string{redacted}
+		}
+		form[name] = values
+	}
+	return form
+}
+
+func newDebugInfo(report *PanicReport, r *http.Request, opts Options) *DebugInfo {
+	stack := make([]DebugFrame, 0, len(report.Stack))
+	for _, f := range report.Stack {
+		stack = append(stack, DebugFrame{
+			Frame:  f,
+			Source: sourceExcerpt(f.File, f.Line),
+		})
+	}
+	return &DebugInfo{
+		Error:      report.Error(),
+		Method:     report.Method,
+		URL:        report.URL,
+		Path:       r.URL.Path,
+		RemoteAddr: r.RemoteAddr,
+		RequestID:  report.RequestID,
+		Header:     report.Header,
+		Form:       formValues(r, opts),
+		Stack:      stack,
+	}
+}
+
+// devPage is the model of the HTML page, which needs the CSP nonce for its inline styles.
+type devPage struct {
+	*DebugInfo
+	Nonce string
+}
+
+// sortedKeys returns the keys of a map in alphabetical order for stable rendering.
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var devPageTemplate = template.Must(template.New("devpage").Funcs(template.FuncMap{
+	"sortedKeys": sortedKeys,
+	"join":       strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Panic: {{ .Error }}</title>
+<style{{ if .Nonce }} nonce="{{ .Nonce }}"{{ end }}>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+h1 { color: #b00020; font-size: 1.4em; word-break: break-word; }
+h2 { font-size: 1.1em; margin-top: 2em; }
+table { border-collapse: collapse; }
+td { padding: 2px 12px 2px 0; vertical-align: top; font-family: monospace; }
+.frame { margin-bottom: 1em; }
+.func { font-weight: bold; font-family: monospace; }
+.file { color: #666; font-family: monospace; }
+pre { background: #f6f6f6; padding: 0.5em; margin: 0.3em 0; overflow-x: auto; }
+.current { background: #ffe0e0; display: block; }
+</style>
+</head>
+<body>
+<h1>{{ .Error }}</h1>
+<h2>Route</h2>
+<table>
+<tr><td>Method</td><td>{{ .Method }}</td></tr>
+<tr><td>URL</td><td>{{ .URL }}</td></tr>
+<tr><td>Path</td><td>{{ .Path }}</td></tr>
+<tr><td>Remote address</td><td>{{ .RemoteAddr }}</td></tr>
+{{ if .RequestID }}<tr><td>Request ID</td><td>{{ .RequestID }}</td></tr>{{ end }}
+</table>
+<h2>Stack</h2>
+{{ range .Stack }}<div class="frame">
+<div class="func">{{ .Function }}</div>
+<div class="file">{{ .File }}:{{ .Line }}</div>
+{{ if .Source }}<pre>{{ range .Source }}<span{{ if .Current }} class="current"{{ end }}>{{ printf "%5d" .Number }}  {{ .Code }}</span>
+{{ end }}</pre>{{ end }}
+</div>
+{{ end }}
+<h2>Headers</h2>
+<table>
+{{ $header := .Header }}{{ range sortedKeys $header }}<tr><td>{{ . }}</td><td>{{ join (index $header .) ", " }}</td></tr>
+{{ end }}
+</table>
+<h2>Form values</h2>
+<table>
+{{ $form := .Form }}{{ range sortedKeys $form }}<tr><td>{{ . }}</td><td>{{ join (index $form .) ", " }}</td></tr>
+{{ end }}
+</table>
+</body>
+</html>
+`))
+
+// DevErrorPage returns a ReportFunc which responds with a detailed error page, including
+// the stack with source code excerpts, the request headers, form values and route information.
+// The page is rendered as HTML if the client accepts it and as JSON otherwise.
+// The inline styles carry the CSP nonce of the headers.SecurityPolicy middleware, if any.
+//
+// The page reveals implementation details and must never be used in production,
+// which is why the fallback is returned unless devMode is switched on.
+func DevErrorPage(devMode bool, opts Options, fallback ReportFunc) ReportFunc {
+	if !devMode {
+		return fallback
+	}
+	return func(report *PanicReport) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			info := newDebugInfo(report, r, opts)
+			w.Header().Set("Cache-Control", "no-store")
+			if strings.Contains(r.Header.Get("Accept"), "text/html") {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				w.WriteHeader(http.StatusInternalServerError)
+				_ = devPageTemplate.Execute(w, devPage{DebugInfo: info, Nonce: headers.GetNonce(r.Context())})
+				return
+			}
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusInternalServerError)
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			_ = encoder.Encode(info)
+		}
+	}
+}
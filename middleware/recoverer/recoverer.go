@@ -3,24 +3,38 @@ package recoverer
 import (
 	"errors"
 	"net/http"
+
+	"github.com/dusted-go/http/v6/middleware/mware"
 )
 
 // RecoverFunc responds to a HTTP request which ended up panicking.
 type RecoverFunc func(recovered any) http.HandlerFunc
 
 // HandlePanics is a middleware which handles a panic and recovers gracefully by calling the RecovererFunc.
+//
+// If the response header has been written already then the panic gets logged
+// and the connection aborted instead of calling the RecoverFunc.
 func HandlePanics(f RecoverFunc) func(http.Handler) http.Handler {
+	opts := Options{}
+	reportFunc := func(report *PanicReport) http.HandlerFunc {
+		return f(report.Value)
+	}
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(
 			func(w http.ResponseWriter, r *http.Request) {
+				rw := mware.NewResponseWriter(w)
 				defer func() {
 					if recovered := recover(); recovered != nil {
 						if err, ok := recovered.(error); !ok || !errors.Is(err, http.ErrAbortHandler) {
-							f(recovered)(w, r)
+							if rw.Committed() {
+								opts.recover(recovered, reportFunc, rw, r)
+								return
+							}
+							f(recovered)(rw, r)
 						}
 					}
 				}()
-				next.ServeHTTP(w, r)
+				next.ServeHTTP(rw, r)
 			},
 		)
 	}
@@ -0,0 +1,258 @@
+package recoverer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"runtime"
+	"strings"
+
+	"github.com/dusted-go/http/v6/middleware/mware"
+)
+
+const redacted = "[REDACTED]"
+
+var (
+	// DefaultRedactedHeaders are the request headers whose values are never included in a PanicReport.
+	DefaultRedactedHeaders = []string{
+		"Authorization",
+		"Proxy-Authorization",
+		"Cookie",
+		"X-Api-Key",
+		"X-Auth-Token",
+		"X-Csrf-Token",
+	}
+
+	// DefaultRedactedQueryParams are the query parameters whose values are never included in a PanicReport.
+	DefaultRedactedQueryParams = []string{
+		"access_token",
+		"api_key",
+		"password",
+		"secret",
+		"token",
+	}
+)
+
+// middlewarePrefix is used to trim the frames of the middlewares from stack traces.
+var middlewarePrefix = func() string {
+	pc, _, _, _ := runtime.Caller(0)
+	name := runtime.FuncForPC(pc).Name()
+	pkgPath := name[:strings.LastIndex(name, "/")+1]
+	pkgName := strings.Split(name[len(pkgPath):], ".")[0]
+	return pkgPath + pkgName + ".HandlePanic"
+}()
+
+// Frame is a single function call of a stack trace.
+type Frame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+func (f Frame) String() string {
+	return fmt.Sprintf("%s\n\t%s:%d", f.Function, f.File, f.Line)
+}
+
+// PanicReport describes a panic which occurred while serving a HTTP request.
+type PanicReport struct {
+	// Value is the value which has been passed to panic.
+	Value any
+
+	// Stack contains the stack trace from the panicking function up to the recoverer middleware.
+	Stack []Frame
+
+	Method string
+	URL    string
+
+	// Header contains the request headers, with the values of sensitive headers redacted.
+	Header http.Header
+
+	// RequestID is the value of the request ID header, if any.
+	RequestID string
+
+	// ResponseStarted is true if the response header had been written before the panic occurred.
+	ResponseStarted bool
+}
+
+// Error returns the panic value as a string.
+func (p *PanicReport) Error() string {
+	if err, ok := p.Value.(error); ok {
+		return err.Error()
+	}
+	return fmt.Sprint(p.Value)
+}
+
+// StackTrace returns the stack as a string in a similar format to runtime/debug.Stack.
+func (p *PanicReport) StackTrace() string {
+	frames := make([]string, 0, len(p.Stack))
+	for _, f := range p.Stack {
+		frames = append(frames, f.String())
+	}
+	return strings.Join(frames, "\n")
+}
+
+// ReportFunc responds to a HTTP request which ended up panicking.
+type ReportFunc func(report *PanicReport) http.HandlerFunc
+
+// Options configures the information which is collected in a PanicReport.
+type Options struct {
+	// RequestIDHeader is the request header which carries the request ID (e.g. X-Request-ID).
+	RequestIDHeader string
+
+	// RedactedHeaders are added to the DefaultRedactedHeaders.
+	RedactedHeaders []string
+
+	// RedactedQueryParams are added to the DefaultRedactedQueryParams.
+	RedactedQueryParams []string
+
+	// Report is called with every PanicReport before the ReportFunc, including panics which
+	// occurred after the response had started. It defaults to writing the report to the standard logger.
+	Report func(report *PanicReport)
+
+	// CommittedMarker is appended to a response which had already started when the panic occurred.
+	// If it is empty then the connection gets aborted instead, which makes the
+	// truncated response recognizable as failed by the client.
+	CommittedMarker string
+}
+
+func logReport(report *PanicReport) {
+	log.Printf("http: panic serving %s %s: %s\n%s", report.Method, report.URL, report.Error(), report.StackTrace())
+}
+
+// recover reports the panic and either calls the ReportFunc or,
+// if the response had started already, completes the response safely.
+func (o Options) recover(recovered any, f ReportFunc, w *mware.ResponseWriter, r *http.Request) {
+	report := o.newReport(recovered, r, w)
+	if o.Report != nil {
+		o.Report(report)
+	} else {
+		logReport(report)
+	}
+
+	if !report.ResponseStarted {
+		f(report)(w, r)
+		return
+	}
+	if o.CommittedMarker != "" {
+		_, _ = io.WriteString(w, o.CommittedMarker)
+		return
+	}
+	panic(http.ErrAbortHandler)
+}
+
+// captureStack returns the stack of the panicking goroutine, starting at the function
+// which called panic and ending before the frames of the recoverer middleware.
+func captureStack() []Frame {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	stack := []Frame{}
+	panicked := false
+	for {
+		frame, more := frames.Next()
+		switch {
+		case !panicked:
+			// Skip the frames of the deferred recover and the runtime's panic handling:
+			panicked = frame.Function == "runtime.gopanic"
+		case strings.HasPrefix(frame.Function, middlewarePrefix):
+			return stack
+		case len(stack) == 0 && strings.HasPrefix(frame.Function, "runtime."):
+			// Skip runtime frames of implicit panics (e.g. runtime.sigpanic):
+		default:
+			stack = append(stack, Frame{
+				Function: frame.Function,
+				File:     frame.File,
+				Line:     frame.Line,
+			})
+		}
+		if !more {
+			return stack
+		}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o Options) redactHeader(header http.Header) http.Header {
+	h := header.Clone()
+	for name := range h {
+		if contains(DefaultRedactedHeaders, name) || contains(o.RedactedHeaders, name) {
+			h[name] = []string{redacted}
+		}
+	}
+	return h
+}
+
+func (o Options) redactURL(r *http.Request) string {
+	u := *r.URL
+	if u.Host == "" {
+		u.Host = r.Host
+	}
+	if u.Scheme == "" {
+		u.Scheme = "http"
+		if r.TLS != nil {
+			u.Scheme = "https"
+		}
+	}
+	query := u.Query()
+	changed := false
+	for name := range query {
+		if contains(DefaultRedactedQueryParams, name) || contains(o.RedactedQueryParams, name) {
+			query[name] = []string{redacted}
+			changed = true
+		}
+	}
+	if changed {
+		u.RawQuery = query.Encode()
+	}
+	return u.Redacted()
+}
+
+// newReport creates a PanicReport. It must be called from the deferred function which recovered the panic.
+func (o Options) newReport(recovered any, r *http.Request, w *mware.ResponseWriter) *PanicReport {
+	report := &PanicReport{
+		Value:           recovered,
+		Stack:           captureStack(),
+		Method:          r.Method,
+		URL:             o.redactURL(r),
+		Header:          o.redactHeader(r.Header),
+		ResponseStarted: w.Committed(),
+	}
+	if o.RequestIDHeader != "" {
+		report.RequestID = r.Header.Get(o.RequestIDHeader)
+	}
+	return report
+}
+
+// HandlePanicReports is a middleware which handles a panic and recovers gracefully
+// by calling the ReportFunc with a detailed PanicReport.
+//
+// The ReportFunc is not called if the response header has been written already,
+// because writing an error page would corrupt the response (see Options.CommittedMarker).
+func HandlePanicReports(opts Options, f ReportFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				rw := mware.NewResponseWriter(w)
+				defer func() {
+					if recovered := recover(); recovered != nil {
+						if err, ok := recovered.(error); !ok || !errors.Is(err, http.ErrAbortHandler) {
+							opts.recover(recovered, f, rw, r)
+						}
+					}
+				}()
+				next.ServeHTTP(rw, r)
+			},
+		)
+	}
+}
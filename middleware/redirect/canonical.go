@@ -0,0 +1,299 @@
+package redirect
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/dusted-go/http/v6/middleware/mware"
+)
+
+// TrailingSlashMode defines how Canonicalize treats trailing slashes.
+type TrailingSlashMode int
+
+const (
+	// KeepTrailingSlash leaves trailing slashes as they are.
+	KeepTrailingSlash TrailingSlashMode = iota
+
+	// StripTrailingSlash removes trailing slashes (except for the root path).
+	StripTrailingSlash
+
+	// AddTrailingSlash adds a trailing slash to all paths whose last segment doesn't look like a file name.
+	AddTrailingSlash
+)
+
+// DefaultTrackingParams are query parameters which are commonly added by analytics and ad platforms.
+var DefaultTrackingParams = []string{"utm_*", "fbclid", "gclid", "msclkid", "mc_cid", "mc_eid"}
+
+// CanonicalOptions configures the Canonicalize middleware.
+type CanonicalOptions struct {
+	// HTTPS redirects http:// requests to https:// if it's not nil (see ForceHTTPSWith).
+	// Its HSTS setting is ignored, because Canonicalize doesn't modify responses.
+	HTTPS *HTTPSOptions
+
+	// Hosts redirects from one host to another (e.g. www.foo.bar -> foo.bar).
+	Hosts map[string]string
+
+	CollapseSlashes    bool
+	ResolveDotSegments bool
+	LowercasePath      bool
+	NormalizeEncoding  bool
+	TrailingSlash      TrailingSlashMode
+
+	// StripQueryParams removes the given query parameters.
+	// A trailing * matches all parameters with that prefix (e.g. utm_*).
+	StripQueryParams []string
+	SortQuery        bool
+}
+
+// collapseSlashes replaces repeated slashes with a single one.
+func collapseSlashes(p string) string {
+	for strings.Contains(p, "//") {
+		p = strings.ReplaceAll(p, "//", "/")
+	}
+	return p
+}
+
+// resolveDotSegments removes . and .. segments as described in RFC 3986 section 5.2.4.
+func resolveDotSegments(p string) string {
+	segments := strings.Split(p, "/")
+	resolved := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+			if last {
+				resolved = append(resolved, "")
+			}
+		case "..":
+			if len(resolved) > 1 {
+				resolved = resolved[:len(resolved)-1]
+			}
+			if last {
+				resolved = append(resolved, "")
+			}
+		default:
+			resolved = append(resolved, segment)
+		}
+	}
+	result := strings.Join(resolved, "/")
+	if !strings.HasPrefix(result, "/") {
+		result = "/" + result
+	}
+	return result
+}
+
+func isUnreserved(c byte) bool {
+	return (c >= 'a' && c <= 'z') ||
+		(c >= 'A' && c <= 'Z') ||
+		(c >= '0' && c <= '9') ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func unhex(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	default:
+		return 0, false
+	}
+}
+
+// normalizeEncoding decodes percent-encoded unreserved characters
+// and uppercases the hex digits of all other percent-encodings.
+func normalizeEncoding(p string) string {
+	sb := strings.Builder{}
+	for i := 0; i < len(p); i++ {
+		if p[i] == '%' && i+2 < len(p) {
+			hi, ok1 := unhex(p[i+1])
+			lo, ok2 := unhex(p[i+2])
+			if ok1 && ok2 {
+				if c := hi<<4 | lo; isUnreserved(c) {
+					sb.WriteByte(c)
+				} else {
+					sb.WriteString("%" + strings.ToUpper(p[i+1:i+3]))
+				}
+				i += 2
+				continue
+			}
+		}
+		sb.WriteByte(p[i])
+	}
+	return sb.String()
+}
+
+// lowercasePath lowercases a path without touching percent-encodings.
+func lowercasePath(p string) string {
+	b := []byte(p)
+	for i := 0; i < len(b); i++ {
+		if b[i] == '%' {
+			i += 2
+			continue
+		}
+		if b[i] >= 'A' && b[i] <= 'Z' {
+			b[i] += 'a' - 'A'
+		}
+	}
+	return string(b)
+}
+
+func applyTrailingSlash(p string, mode TrailingSlashMode) string {
+	switch mode {
+	case StripTrailingSlash:
+		if len(p) > 1 && strings.HasSuffix(p, "/") {
+			return strings.TrimRight(p, "/")
+		}
+	case AddTrailingSlash:
+		lastSegment := p[strings.LastIndex(p, "/")+1:]
+		if !strings.HasSuffix(p, "/") && !strings.Contains(lastSegment, ".") {
+			return p + "/"
+		}
+	}
+	return p
+}
+
+func matchesParam(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(name, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+		} else if pattern == name {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalQuery strips and sorts query parameters while preserving their original encoding.
+// Empty parameters (e.g. of a trailing &) are only dropped when the query gets rewritten anyway.
+func canonicalQuery(rawQuery string, strip []string, sortQuery bool) string {
+	if rawQuery == "" || (len(strip) == 0 && !sortQuery) {
+		return rawQuery
+	}
+	type param struct {
+		name string
+		raw  string
+	}
+	params := []param{}
+	stripped := false
+	for _, raw := range strings.Split(rawQuery, "&") {
+		if raw == "" {
+			continue
+		}
+		name := strings.SplitN(raw, "=", 2)[0]
+		if decoded, err := url.QueryUnescape(name); err == nil {
+			name = decoded
+		}
+		if matchesParam(strip, name) {
+			stripped = true
+			continue
+		}
+		params = append(params, param{name: name, raw: raw})
+	}
+	if !stripped && !sortQuery {
+		return rawQuery
+	}
+	if sortQuery {
+		sort.SliceStable(params, func(i, j int) bool {
+			return params[i].name < params[j].name
+		})
+	}
+	raws := make([]string, 0, len(params))
+	for _, p := range params {
+		raws = append(raws, p.raw)
+	}
+	return strings.Join(raws, "&")
+}
+
+// canonicalPath normalises the percent-encoding first (RFC 3986 section 6.2.2),
+// because decoded characters such as . or A are subject to the other steps,
+// and the canonical path must be reached with a single redirect.
+func (o CanonicalOptions) canonicalPath(p string) string {
+	if o.NormalizeEncoding {
+		p = normalizeEncoding(p)
+	}
+	if o.CollapseSlashes {
+		p = collapseSlashes(p)
+	}
+	if o.ResolveDotSegments {
+		p = resolveDotSegments(p)
+	}
+	if o.LowercasePath {
+		p = lowercasePath(p)
+	}
+	return applyTrailingSlash(p, o.TrailingSlash)
+}
+
+func (o CanonicalOptions) forceHTTPS(r *http.Request) bool {
+	return o.HTTPS != nil && o.HTTPS.matches(r.Host) && !o.HTTPS.exempt(r)
+}
+
+// permanentRedirectStatus returns 301 for GET and HEAD requests and 308 for all other
+// methods, which makes clients repeat the request with the same method and body.
+func permanentRedirectStatus(r *http.Request) int {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return http.StatusMovedPermanently
+	}
+	return http.StatusPermanentRedirect
+}
+
+// Canonicalize is a middleware which redirects requests to their canonical URL.
+//
+// All configured normalizations (scheme, host, path and query) are combined
+// into a single redirect, which avoids redirect chains when it's used instead of
+// the separate ForceHTTPS, Hosts and TrailingSlash middlewares.
+func Canonicalize(opts CanonicalOptions) func(http.Handler) http.Handler {
+	strip := opts.StripQueryParams
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				// Asterisk and authority form requests (OPTIONS * and CONNECT) have no path to canonicalize:
+				if !mware.IsHTTP(r) || r.URL.Path == "*" || r.Method == http.MethodConnect {
+					next.ServeHTTP(w, r)
+					return
+				}
+
+				scheme := httpProto
+				if isHTTPS(r) {
+					scheme = httpsProto
+				}
+				host := r.Host
+				// Use the path as sent by the client, before any decoding:
+				rawPath := strings.SplitN(mware.RequestURI(r), "?", 2)[0]
+				rawQuery := r.URL.RawQuery
+
+				canonicalScheme := scheme
+				canonicalHost := host
+				if dest, ok := opts.Hosts[host]; ok {
+					canonicalHost = dest
+				}
+				if scheme == httpProto && opts.forceHTTPS(r) {
+					canonicalScheme = httpsProto
+					canonicalHost = opts.HTTPS.httpsHost(canonicalHost)
+				}
+				canonicalPath := opts.canonicalPath(rawPath)
+				canonicalRawQuery := canonicalQuery(rawQuery, strip, opts.SortQuery)
+
+				if canonicalScheme == scheme &&
+					canonicalHost == host &&
+					canonicalPath == rawPath &&
+					canonicalRawQuery == rawQuery {
+					next.ServeHTTP(w, r)
+					return
+				}
+
+				target := canonicalScheme + "://" + canonicalHost + canonicalPath
+				if canonicalRawQuery != "" {
+					target += "?" + canonicalRawQuery
+				}
+				http.Redirect(w, r, target, permanentRedirectStatus(r))
+			},
+		)
+	}
+}
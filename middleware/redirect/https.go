@@ -0,0 +1,121 @@
+package redirect
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/dusted-go/http/v6/middleware/headers"
+	"github.com/dusted-go/http/v6/middleware/mware"
+)
+
+// ACMEChallengePath is the path prefix of ACME http-01 challenges,
+// which must be answered over plain HTTP.
+const ACMEChallengePath = "/.well-known/acme-challenge/"
+
+// HTTPSOptions configures the ForceHTTPSWith middleware.
+type HTTPSOptions struct {
+	// Hosts are host names (e.g. example.com) or wildcard patterns (e.g. *.example.com)
+	// which get redirected to HTTPS. An empty list matches all hosts.
+	Hosts []string
+
+	// Ports maps the port of a HTTP request to the port of the HTTPS server (e.g. 8080 -> 8443).
+	// Requests on any other port get redirected to the default HTTPS port.
+	Ports map[string]string
+
+	// ExemptACMEChallenges serves requests to the ACMEChallengePath without redirecting them.
+	ExemptACMEChallenges bool
+
+	// HSTS is sent with HTTPS responses of matching hosts, so that browsers use HTTPS
+	// straight away on subsequent visits. Browsers ignore the header on plain HTTP responses.
+	HSTS *headers.HSTS
+}
+
+// splitHost splits a host into name and port. The port is empty if the host doesn't have one.
+func splitHost(host string) (string, string) {
+	name, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return host, ""
+	}
+	return name, port
+}
+
+// matchHost reports whether the host matches a host name or a wildcard pattern.
+// A wildcard matches one or more subdomain labels, but not the domain itself.
+func matchHost(pattern, host string) bool {
+	if strings.HasPrefix(pattern, "*.") {
+		suffix := pattern[1:]
+		return len(host) > len(suffix) && strings.HasSuffix(strings.ToLower(host), strings.ToLower(suffix))
+	}
+	return strings.EqualFold(pattern, host)
+}
+
+func (o HTTPSOptions) matches(host string) bool {
+	if len(o.Hosts) == 0 {
+		return true
+	}
+	name, _ := splitHost(host)
+	for _, pattern := range o.Hosts {
+		// Patterns with a port must match the host exactly:
+		if matchHost(pattern, host) || matchHost(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o HTTPSOptions) exempt(r *http.Request) bool {
+	return o.ExemptACMEChallenges && strings.HasPrefix(r.URL.Path, ACMEChallengePath)
+}
+
+// httpsHost returns the host of the HTTPS server for the given HTTP host.
+func (o HTTPSOptions) httpsHost(host string) string {
+	name, port := splitHost(host)
+	if port == "" {
+		return host
+	}
+	if httpsPort, ok := o.Ports[port]; ok && httpsPort != "443" {
+		return net.JoinHostPort(name, httpsPort)
+	}
+	if strings.Contains(name, ":") {
+		// IPv6 literals must be enclosed in brackets:
+		return "[" + name + "]"
+	}
+	return name
+}
+
+// ForceHTTPSWith is a middleware which redirects http:// requests to https://
+// for all hosts which match the HTTPSOptions.
+//
+// GET and HEAD requests are redirected with 301 and all other methods with 308,
+// so that clients repeat them with the same method and body.
+func ForceHTTPSWith(opts HTTPSOptions) func(http.Handler) http.Handler {
+	var hsts string
+	if opts.HSTS != nil {
+		hsts = opts.HSTS.String()
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if !mware.IsHTTP(r) || !opts.matches(r.Host) {
+					next.ServeHTTP(w, r)
+					return
+				}
+				if isHTTPS(r) {
+					if hsts != "" {
+						w.Header().Set("Strict-Transport-Security", hsts)
+					}
+					next.ServeHTTP(w, r)
+					return
+				}
+				if opts.exempt(r) {
+					next.ServeHTTP(w, r)
+					return
+				}
+				r2 := *r
+				r2.Host = opts.httpsHost(r.Host)
+				http.Redirect(w, r, fullURL(&r2, httpsProto), permanentRedirectStatus(r))
+			},
+		)
+	}
+}
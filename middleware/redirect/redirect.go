@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+
+	"github.com/dusted-go/http/v6/middleware/mware"
 )
 
 const (
@@ -12,7 +14,7 @@ const (
 )
 
 func isHTTPS(r *http.Request) bool {
-	return strings.HasPrefix(r.Proto, "HTTP") &&
+	return mware.IsHTTP(r) &&
 		(r.TLS != nil || strings.ToLower(r.Header.Get("X-Forwarded-Proto")) == httpsProto)
 }
 
@@ -25,51 +27,23 @@ func fullURL(r *http.Request, desiredScheme string) string {
 			scheme = httpProto
 		}
 	}
-
-	pathAndQuery := r.RequestURI
-	if pathAndQuery == "" {
-		pathAndQuery = r.URL.Path
-		if r.URL.User.String() != "" {
-			pathAndQuery = r.URL.User.String() + "@" + pathAndQuery
-		}
-		if r.URL.RawQuery != "" {
-			pathAndQuery += "?" + r.URL.RawQuery
-		}
-		if r.URL.Fragment != "" {
-			pathAndQuery += "#" + r.URL.Fragment
-		}
-	}
-
-	return fmt.Sprintf("%s://%s%s", scheme, r.Host, pathAndQuery)
+	return fmt.Sprintf("%s://%s%s", scheme, r.Host, mware.RequestURI(r))
 }
 
 // ForceHTTPS is a middleware which redirects http:// requests to https://
+// for the given hosts, which can be host names or wildcard patterns (e.g. *.foo.bar).
+//
+// See ForceHTTPSWith for port mapping, ACME challenge exemptions and HSTS.
 func ForceHTTPS(
 	enable bool,
 	hosts ...string,
 ) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(
-			func(w http.ResponseWriter, r *http.Request) {
-				if enable {
-					isMatch := false
-					for _, h := range hosts {
-						if h == r.Host {
-							isMatch = true
-							break
-						}
-					}
-					redirect := isMatch && !isHTTPS(r)
-					if redirect {
-						url := fullURL(r, httpsProto)
-						http.Redirect(w, r, url, 301)
-						return
-					}
-				}
-				next.ServeHTTP(w, r)
-			},
-		)
+	if !enable || len(hosts) == 0 {
+		return func(next http.Handler) http.Handler {
+			return next
+		}
 	}
+	return ForceHTTPSWith(HTTPSOptions{Hosts: hosts})
 }
 
 // TrailingSlash is a middleware which will redirect a matching request with
@@ -79,7 +53,7 @@ func TrailingSlash(next http.Handler) http.Handler {
 		func(w http.ResponseWriter, r *http.Request) {
 			path := r.URL.Path
 			redirect :=
-				strings.HasPrefix(r.Proto, "HTTP") && // Must be HTTP request
+				mware.IsHTTP(r) && // Must be HTTP request
 					len(path) > 1 && // Skip if it is just the root (/) path
 					path[len(path)-1] == '/' // Must have trailing slash
 
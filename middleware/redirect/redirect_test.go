@@ -0,0 +1,233 @@
+package redirect
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dusted-go/http/v6/middleware/headers"
+)
+
+func areEqual[T comparable](t *testing.T, expected, actual T) {
+	if expected != actual {
+		t.Errorf("Expected: %v, Actual: %v", expected, actual)
+	}
+}
+
+const rulesFile = `
+# Old blog
+/about              /company/about
+/blog/*             /posts/*           308
+/p/{id}/{slug}      /posts/{slug}      302  drop-query
+/feed.xml           https://feeds.example.org/main
+`
+
+func Test_Rules_Match(t *testing.T) {
+	rules, err := ParseRules(strings.NewReader(rulesFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := NewRules(rules...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		target   string
+		expected string
+		status   int
+	}{
+		{"/about?x=1", "/company/about?x=1", 301},
+		{"/blog/2022/hello", "/posts/2022/hello", 308},
+		{"/blog", "/posts", 308},
+		{"/p/12/hello-world?utm=1", "/posts/hello-world", 302},
+		{"/feed.xml", "https://feeds.example.org/main", 301},
+		// Decoded characters must not end up unescaped in the destination:
+		{"/p/12/a%3Fb", "/posts/a%3Fb", 302},
+		{"/p/12/a%2Fb", "/posts/a%2Fb", 302},
+		{"/blog/a%3Fb/c%23d", "/posts/a%3Fb/c%23d", 308},
+		{"/blog/caf%C3%A9", "/posts/caf%C3%A9", 308},
+	} {
+		dest, status, ok := rs.Match(httptest.NewRequest(http.MethodGet, tc.target, nil))
+		areEqual(t, true, ok)
+		areEqual(t, tc.expected, dest)
+		areEqual(t, tc.status, status)
+	}
+
+	_, _, ok := rs.Match(httptest.NewRequest(http.MethodGet, "/blogger", nil))
+	areEqual(t, false, ok)
+}
+
+func Test_Rules_WatchFile_RequiresFile(t *testing.T) {
+	rs, err := NewRules(Rule{From: "/a", To: "/b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rs.WatchFile(context.Background(), time.Second, func(error) {})
+	areEqual(t, true, err != nil)
+}
+
+func Test_Rules_WatchFile_RequiresInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "redirects")
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rs, err := LoadRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	areEqual(t, true, rs.WatchFile(ctx, 0, func(error) {}) != nil)
+	areEqual(t, true, rs.WatchFile(ctx, time.Hour, func(error) {}) == nil)
+}
+
+func Test_NewRules_DetectsLoopsAndChains(t *testing.T) {
+	for _, rules := range [][]Rule{
+		{{From: "/a", To: "/a"}},
+		{{From: "/a", To: "/b"}, {From: "/b", To: "/a"}},
+		{{From: "/blog/*", To: "/blog/posts/*"}},
+		{{From: "/a", To: "/b"}, {From: "/b", To: "/c"}},
+		{{From: "/old/{slug}", To: "/new/{slug}"}, {From: "/new/*", To: "/newest/*"}},
+	} {
+		if _, err := NewRules(rules...); err == nil {
+			t.Errorf("Expected an error for %v", rules)
+		}
+	}
+}
+
+func Test_NewRules_InvalidRules(t *testing.T) {
+	for _, rule := range []Rule{
+		{From: "/a", To: "/b", Status: 200},
+		{From: "a", To: "/b"},
+		{From: "/a", To: "b"},
+		{From: "/p/{id}", To: "/posts/{slug}"},
+		{From: "/p/x{id}", To: "/posts"},
+	} {
+		if _, err := NewRules(rule); err == nil {
+			t.Errorf("Expected an error for %v", rule)
+		}
+	}
+}
+
+func Test_Canonicalize(t *testing.T) {
+	opts := CanonicalOptions{
+		HTTPS:              &HTTPSOptions{},
+		Hosts:              map[string]string{"www.example.org": "example.org"},
+		CollapseSlashes:    true,
+		ResolveDotSegments: true,
+		LowercasePath:      true,
+		NormalizeEncoding:  true,
+		TrailingSlash:      AddTrailingSlash,
+		StripQueryParams:   DefaultTrackingParams,
+		SortQuery:          true,
+	}
+	handler := Canonicalize(opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, tc := range []struct {
+		method   string
+		target   string
+		status   int
+		location string
+	}{
+		{http.MethodGet, "https://example.org/blog/", 200, ""},
+		{http.MethodGet, "https://example.org/style.css", 200, ""},
+		{http.MethodGet, "https://example.org/a?b=1&c=2", 301, "https://example.org/a/?b=1&c=2"},
+		{http.MethodGet, "http://www.example.org//Blog/./2022/../%7euser%2f?utm_source=x&z=1&a=%C3%A4&fbclid=y",
+			301, "https://example.org/blog/~user%2F/?a=%C3%A4&z=1"},
+		{http.MethodPost, "http://example.org/form/", 308, "https://example.org/form/"},
+		{http.MethodGet, "https://example.org/a/%2E%2E/b/", 301, "https://example.org/b/"},
+		{http.MethodGet, "https://example.org/%41/", 301, "https://example.org/a/"},
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(tc.method, tc.target, nil))
+		areEqual(t, tc.status, w.Code)
+		areEqual(t, tc.location, w.Header().Get("Location"))
+
+		// A single redirect must lead to the canonical URL:
+		if tc.location != "" {
+			w = httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(tc.method, tc.location, nil))
+			areEqual(t, http.StatusOK, w.Code)
+		}
+	}
+}
+
+func Test_Canonicalize_QueryUntouchedUnlessConfigured(t *testing.T) {
+	for _, tc := range []struct {
+		opts     CanonicalOptions
+		target   string
+		status   int
+		location string
+	}{
+		{CanonicalOptions{CollapseSlashes: true}, "/a?x=1&", 200, ""},
+		{CanonicalOptions{CollapseSlashes: true}, "//a?x=1&", 301, "http://example.com/a?x=1&"},
+		{CanonicalOptions{StripQueryParams: []string{"utm_*"}}, "/a?x=1&", 200, ""},
+		{CanonicalOptions{StripQueryParams: []string{"utm_*"}}, "/a?x=1&&utm_source=y", 301, "http://example.com/a?x=1"},
+		{CanonicalOptions{SortQuery: true}, "/a?x=1&", 301, "http://example.com/a?x=1"},
+	} {
+		handler := Canonicalize(tc.opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.target, nil))
+		areEqual(t, tc.status, w.Code)
+		areEqual(t, tc.location, w.Header().Get("Location"))
+	}
+}
+
+func Test_ForceHTTPSWith(t *testing.T) {
+	opts := HTTPSOptions{
+		Hosts:                []string{"example.org", "*.example.com"},
+		Ports:                map[string]string{"8080": "8443"},
+		ExemptACMEChallenges: true,
+		HSTS:                 &headers.HSTS{MaxAge: 60},
+	}
+	handler := ForceHTTPSWith(opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, tc := range []struct {
+		method   string
+		target   string
+		status   int
+		location string
+		hsts     string
+	}{
+		{http.MethodGet, "http://example.org/a?b=1", 301, "https://example.org/a?b=1", ""},
+		{http.MethodPost, "http://api.example.com/a", 308, "https://api.example.com/a", ""},
+		{http.MethodGet, "http://example.org:8080/a", 301, "https://example.org:8443/a", ""},
+		{http.MethodGet, "http://example.org:80/a", 301, "https://example.org/a", ""},
+		{http.MethodGet, "http://example.com/a", 200, "", ""},
+		{http.MethodGet, "http://other.org/a", 200, "", ""},
+		{http.MethodGet, "http://example.org/.well-known/acme-challenge/token", 200, "", ""},
+		{http.MethodGet, "https://example.org/a", 200, "", "max-age=60"},
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(tc.method, tc.target, nil))
+		areEqual(t, tc.status, w.Code)
+		areEqual(t, tc.location, w.Header().Get("Location"))
+		areEqual(t, tc.hsts, w.Header().Get("Strict-Transport-Security"))
+	}
+}
+
+func Test_ForceHTTPS_RequestWithoutRequestURI(t *testing.T) {
+	handler := ForceHTTPS(true, "example.org")(http.NotFoundHandler())
+
+	r, err := http.NewRequest(http.MethodGet, "http://example.org/a%20b?c=d", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Proto = "HTTP/2.0"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	areEqual(t, http.StatusMovedPermanently, w.Code)
+	areEqual(t, "https://example.org/a%20b?c=d", w.Header().Get("Location"))
+}
@@ -0,0 +1,472 @@
+package redirect
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rule maps an old path to a new location.
+//
+// The kind of match depends on From:
+//
+// - Exact: /old-page
+//
+// - Prefix: /blog/* matches /blog and everything below it. If To ends with * as well
+// (e.g. /posts/*), the remainder of the path is appended to it.
+//
+// - Pattern: /blog/{year}/{slug} matches exactly one path segment per placeholder.
+// The captured segments can be used in To (e.g. /posts/{slug}).
+//
+// To can be a path or an absolute URL.
+type Rule struct {
+	From      string
+	To        string
+	Status    int
+	DropQuery bool
+}
+
+type matchKind int
+
+const (
+	matchExact matchKind = iota
+	matchPrefix
+	matchPattern
+)
+
+type compiledRule struct {
+	Rule
+	kind     matchKind
+	segments []string
+	line     int
+}
+
+func (c *compiledRule) String() string {
+	if c.line > 0 {
+		return fmt.Sprintf("rule '%s -> %s' (line %d)", c.From, c.To, c.line)
+	}
+	return fmt.Sprintf("rule '%s -> %s'", c.From, c.To)
+}
+
+func splitSegments(p string) []string {
+	return strings.Split(strings.Trim(p, "/"), "/")
+}
+
+func isPlaceholder(segment string) bool {
+	return len(segment) > 2 && strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+func compileRule(rule Rule, line int) (*compiledRule, error) {
+	c := &compiledRule{Rule: rule, line: line}
+	if c.Status == 0 {
+		c.Status = http.StatusMovedPermanently
+	}
+	switch c.Status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return nil, fmt.Errorf("%s: unsupported status code %d", c, c.Status)
+	}
+	if !strings.HasPrefix(c.From, "/") {
+		return nil, fmt.Errorf("%s: the source must be a path starting with /", c)
+	}
+	if !strings.HasPrefix(c.To, "/") &&
+		!strings.HasPrefix(c.To, "http://") &&
+		!strings.HasPrefix(c.To, "https://") {
+		return nil, fmt.Errorf("%s: the destination must be a path or an absolute URL", c)
+	}
+
+	switch {
+	case strings.HasSuffix(c.From, "/*"):
+		c.kind = matchPrefix
+		c.From = strings.TrimSuffix(c.From, "/*")
+	case strings.Contains(c.From, "{"):
+		c.kind = matchPattern
+		c.segments = splitSegments(c.From)
+		names := map[string]bool{}
+		for _, segment := range c.segments {
+			if isPlaceholder(segment) {
+				names[segment] = true
+			} else if strings.ContainsAny(segment, "{}") {
+				return nil, fmt.Errorf("%s: placeholders must span a whole path segment", c)
+			}
+		}
+		for _, segment := range splitSegments(c.To) {
+			if strings.Contains(segment, "{") && !names[segment] {
+				return nil, fmt.Errorf("%s: the destination uses an unknown placeholder %s", c, segment)
+			}
+		}
+	default:
+		c.kind = matchExact
+	}
+	return c, nil
+}
+
+// unescape decodes an escaped path or path segment. Invalid escapes are kept as they are.
+func unescape(s string) string {
+	if decoded, err := url.PathUnescape(s); err == nil {
+		return decoded
+	}
+	return s
+}
+
+// match returns the destination for the given escaped path or false if the rule doesn't match.
+//
+// The path is compared segment by segment after decoding, but the segments which are copied
+// into the destination remain escaped, so that characters like / or ? keep their meaning.
+func (c *compiledRule) match(p string) (string, bool) {
+	switch c.kind {
+	case matchPrefix:
+		segments := strings.Split(p, "/")
+		prefix := strings.Split(c.From, "/")
+		if len(segments) < len(prefix) {
+			return "", false
+		}
+		for i, segment := range prefix {
+			if unescape(segments[i]) != segment {
+				return "", false
+			}
+		}
+		if !strings.HasSuffix(c.To, "/*") {
+			return c.To, true
+		}
+		dest := strings.TrimSuffix(c.To, "/*")
+		for _, segment := range segments[len(prefix):] {
+			dest += "/" + url.PathEscape(unescape(segment))
+		}
+		return dest, true
+	case matchPattern:
+		segments := splitSegments(p)
+		if len(segments) != len(c.segments) {
+			return "", false
+		}
+		values := []string{}
+		for i, segment := range c.segments {
+			value := unescape(segments[i])
+			if isPlaceholder(segment) {
+				if value == "" {
+					return "", false
+				}
+				values = append(values, segment, url.PathEscape(value))
+			} else if segment != value {
+				return "", false
+			}
+		}
+		return strings.NewReplacer(values...).Replace(c.To), true
+	default:
+		return c.To, unescape(p) == c.From
+	}
+}
+
+// sample returns a path which is matched by the rule.
+func (c *compiledRule) sample() string {
+	switch c.kind {
+	case matchPrefix:
+		return c.From + "/sample"
+	case matchPattern:
+		segments := make([]string, len(c.segments))
+		for i, segment := range c.segments {
+			segments[i] = strings.Trim(segment, "{}")
+		}
+		return "/" + strings.Join(segments, "/")
+	default:
+		return c.From
+	}
+}
+
+// ruleSet is an immutable set of compiled rules.
+type ruleSet struct {
+	exact map[string]*compiledRule
+	other []*compiledRule
+}
+
+func (s *ruleSet) match(p string) (*compiledRule, string, bool) {
+	if c, ok := s.exact[unescape(p)]; ok {
+		return c, c.To, true
+	}
+	for _, c := range s.other {
+		if dest, ok := c.match(p); ok {
+			return c, dest, true
+		}
+	}
+	return nil, "", false
+}
+
+func stripQuery(dest string) string {
+	return strings.SplitN(dest, "?", 2)[0]
+}
+
+// validate detects loops and chains by following the redirect of a sample path of every rule.
+func (s *ruleSet) validate(rules []*compiledRule) error {
+	for _, c := range rules {
+		dest, _ := c.match(c.sample())
+		if !strings.HasPrefix(dest, "/") {
+			continue
+		}
+		next, _, ok := s.match(stripQuery(dest))
+		if !ok {
+			continue
+		}
+
+		// Follow the chain to tell loops apart from chains:
+		visited := map[*compiledRule]bool{c: true}
+		current, p := next, stripQuery(dest)
+		for {
+			if visited[current] {
+				return fmt.Errorf("%s leads to a redirect loop", c)
+			}
+			visited[current] = true
+			d, _ := current.match(p)
+			if !strings.HasPrefix(d, "/") {
+				break
+			}
+			p = stripQuery(d)
+			if current, _, ok = s.match(p); !ok {
+				break
+			}
+		}
+		return fmt.Errorf("%s is followed by %s, redirect to the final destination instead", c, next)
+	}
+	return nil
+}
+
+func newRuleSet(rules []*compiledRule) (*ruleSet, error) {
+	s := &ruleSet{exact: map[string]*compiledRule{}}
+	for _, c := range rules {
+		if c.kind != matchExact {
+			s.other = append(s.other, c)
+			continue
+		}
+		if existing, ok := s.exact[c.From]; ok {
+			return nil, fmt.Errorf("%s conflicts with %s", c, existing)
+		}
+		s.exact[c.From] = c
+	}
+	if err := s.validate(rules); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Rules is a redirect rules engine which can be reloaded at runtime.
+type Rules struct {
+	mutex   sync.RWMutex
+	set     *ruleSet
+	path    string
+	modTime time.Time
+}
+
+func compileRules(rules []Rule, lines []int) (*ruleSet, error) {
+	compiled := make([]*compiledRule, 0, len(rules))
+	for i, rule := range rules {
+		line := 0
+		if lines != nil {
+			line = lines[i]
+		}
+		c, err := compileRule(rule, line)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, c)
+	}
+	return newRuleSet(compiled)
+}
+
+// NewRules creates a rules engine from the given rules.
+// It returns an error if a rule is invalid or if rules form a loop or a chain.
+func NewRules(rules ...Rule) (*Rules, error) {
+	set, err := compileRules(rules, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error compiling redirect rules: %w", err)
+	}
+	return &Rules{set: set}, nil
+}
+
+// ParseRules parses rules from a text format with one rule per line:
+//
+//	# Comment
+//	/old-page        /new-page
+//	/blog/*          /posts/*          308
+//	/p/{id}/{slug}   /posts/{slug}     301   drop-query
+//
+// The status code defaults to 301 and the query string is preserved unless drop-query is set.
+func ParseRules(r io.Reader) ([]Rule, error) {
+	rules, _, err := parseRules(r)
+	return rules, err
+}
+
+// parseRules parses rules and returns the line number of each rule for error messages.
+func parseRules(r io.Reader) ([]Rule, []int, error) {
+	rules := []Rule{}
+	lines := []int{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 2 {
+			return nil, nil, fmt.Errorf("line %d: expected a source and a destination", line)
+		}
+		rule := Rule{From: fields[0], To: fields[1]}
+		for _, field := range fields[2:] {
+			switch field {
+			case "drop-query":
+				rule.DropQuery = true
+			case "keep-query":
+				rule.DropQuery = false
+			default:
+				status, err := strconv.Atoi(field)
+				if err != nil {
+					return nil, nil, fmt.Errorf("line %d: unknown option '%s'", line, field)
+				}
+				rule.Status = status
+			}
+		}
+		rules = append(rules, rule)
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error reading redirect rules: %w", err)
+	}
+	return rules, lines, nil
+}
+
+func loadRuleSet(path string) (*ruleSet, time.Time, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("error opening redirect rules file '%s': %w", path, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("error reading redirect rules file '%s': %w", path, err)
+	}
+	rules, lines, err := parseRules(f)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("error parsing redirect rules file '%s': %w", path, err)
+	}
+	set, err := compileRules(rules, lines)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("error compiling redirect rules file '%s': %w", path, err)
+	}
+	return set, info.ModTime(), nil
+}
+
+// LoadRules creates a rules engine from a file (see ParseRules for the format).
+func LoadRules(path string) (*Rules, error) {
+	set, modTime, err := loadRuleSet(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Rules{set: set, path: path, modTime: modTime}, nil
+}
+
+// Replace swaps all rules at runtime. The current rules remain active if the new rules are invalid.
+func (rs *Rules) Replace(rules ...Rule) error {
+	set, err := compileRules(rules, nil)
+	if err != nil {
+		return fmt.Errorf("error compiling redirect rules: %w", err)
+	}
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	rs.set = set
+	return nil
+}
+
+// Reload reloads the rules from the file they have been loaded from.
+// The current rules remain active if the file contains errors.
+func (rs *Rules) Reload() error {
+	if rs.path == "" {
+		return fmt.Errorf("redirect rules have not been loaded from a file")
+	}
+	set, modTime, err := loadRuleSet(rs.path)
+	if err != nil {
+		return err
+	}
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	rs.set = set
+	rs.modTime = modTime
+	return nil
+}
+
+// WatchFile checks the rules file for changes in the given interval and reloads it when it has been modified.
+// Errors are passed to onError and don't stop watching. Watching stops when ctx is cancelled.
+//
+// It returns an error if the rules have not been loaded from a file or if the interval is not positive.
+func (rs *Rules) WatchFile(ctx context.Context, interval time.Duration, onError func(error)) error {
+	if rs.path == "" {
+		return fmt.Errorf("redirect rules have not been loaded from a file")
+	}
+	if interval <= 0 {
+		return fmt.Errorf("redirect rules watch interval must be positive, but is %s", interval)
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				info, err := os.Stat(rs.path)
+				if err != nil {
+					onError(fmt.Errorf("error checking redirect rules file '%s': %w", rs.path, err))
+					continue
+				}
+				rs.mutex.RLock()
+				modified := !info.ModTime().Equal(rs.modTime)
+				rs.mutex.RUnlock()
+				if modified {
+					if err := rs.Reload(); err != nil {
+						onError(err)
+					}
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Match returns the destination and status code for the given request or false if no rule matches.
+func (rs *Rules) Match(r *http.Request) (string, int, bool) {
+	rs.mutex.RLock()
+	set := rs.set
+	rs.mutex.RUnlock()
+
+	c, dest, ok := set.match(r.URL.EscapedPath())
+	if !ok {
+		return "", 0, false
+	}
+	if !c.DropQuery && r.URL.RawQuery != "" {
+		if strings.Contains(dest, "?") {
+			dest += "&" + r.URL.RawQuery
+		} else {
+			dest += "?" + r.URL.RawQuery
+		}
+	}
+	return dest, c.Status, true
+}
+
+// Redirect is a middleware which redirects all requests matching one of the rules.
+func (rs *Rules) Redirect(next http.Handler) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if dest, status, ok := rs.Match(r); ok {
+				http.Redirect(w, r, dest, status)
+				return
+			}
+			next.ServeHTTP(w, r)
+		},
+	)
+}
@@ -0,0 +1,219 @@
+// Package negotiate selects the representation of a resource (e.g. HTML, JSON or an Atom feed)
+// which suits the client best, based on the Accept header or the extension of the path.
+package negotiate
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Common media types.
+const (
+	HTML = "text/html"
+	JSON = "application/json"
+	XML  = "application/xml"
+	Atom = "application/atom+xml"
+	RSS  = "application/rss+xml"
+)
+
+type mediaTypeKey struct{}
+
+// MediaRange is a single element of an Accept header.
+type MediaRange struct {
+	Type    string
+	Subtype string
+	Params  map[string]string
+	Q       float64
+}
+
+// specificity ranks */* below type/* below type/subtype below type/subtype;params.
+func (m MediaRange) specificity() int {
+	switch {
+	case m.Type == "*":
+		return 0
+	case m.Subtype == "*":
+		return 1
+	case len(m.Params) == 0:
+		return 2
+	default:
+		return 3
+	}
+}
+
+func (m MediaRange) matches(mediaType string) bool {
+	typ, subtype := splitMediaType(mediaType)
+	return (m.Type == "*" || m.Type == typ) && (m.Subtype == "*" || m.Subtype == subtype)
+}
+
+func splitMediaType(mediaType string) (string, string) {
+	mediaType = strings.ToLower(strings.TrimSpace(strings.SplitN(mediaType, ";", 2)[0]))
+	parts := strings.SplitN(mediaType, "/", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// ParseAccept parses an Accept header into media ranges, ordered by their
+// quality and specificity. Invalid elements are skipped.
+func ParseAccept(header string) []MediaRange {
+	ranges := []MediaRange{}
+	for _, element := range strings.Split(header, ",") {
+		parts := strings.Split(element, ";")
+		typ, subtype := splitMediaType(parts[0])
+		if typ == "" || subtype == "" || (typ == "*" && subtype != "*") {
+			continue
+		}
+		m := MediaRange{Type: typ, Subtype: subtype, Q: 1}
+		for _, param := range parts[1:] {
+			kv := strings.SplitN(param, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			name := strings.ToLower(strings.TrimSpace(kv[0]))
+			value := strings.Trim(strings.TrimSpace(kv[1]), `"`)
+			if name == "q" {
+				q, err := strconv.ParseFloat(value, 64)
+				if err != nil || q < 0 || q > 1 {
+					q = 0
+				}
+				m.Q = q
+				continue
+			}
+			if m.Params == nil {
+				m.Params = map[string]string{}
+			}
+			m.Params[name] = value
+		}
+		ranges = append(ranges, m)
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].Q != ranges[j].Q {
+			return ranges[i].Q > ranges[j].Q
+		}
+		return ranges[i].specificity() > ranges[j].specificity()
+	})
+	return ranges
+}
+
+// quality returns the quality of a media type, which is given by the most specific matching range.
+func quality(ranges []MediaRange, mediaType string) float64 {
+	best := -1
+	q := 0.0
+	for _, m := range ranges {
+		if m.matches(mediaType) && m.specificity() > best {
+			best = m.specificity()
+			q = m.Q
+		}
+	}
+	return q
+}
+
+// Best returns the offered media type which is most acceptable according to the Accept header.
+// Offers which are equally acceptable are chosen in the given order and the first offer
+// is returned if the header is empty. It returns false if none of the offers is acceptable.
+func Best(accept string, offers ...string) (string, bool) {
+	if len(offers) == 0 {
+		return "", false
+	}
+	if strings.TrimSpace(accept) == "" {
+		return offers[0], true
+	}
+	ranges := ParseAccept(accept)
+	best := ""
+	bestQ := 0.0
+	for _, offer := range offers {
+		if q := quality(ranges, offer); q > bestQ {
+			best = offer
+			bestQ = q
+		}
+	}
+	return best, bestQ > 0
+}
+
+// MediaType returns the media type which has been selected for the current request.
+func MediaType(ctx context.Context) string {
+	if mediaType, ok := ctx.Value(mediaTypeKey{}).(string); ok {
+		return mediaType
+	}
+	return ""
+}
+
+// Representation is a format in which a resource can be served.
+type Representation struct {
+	MediaType string
+
+	// Extension (e.g. .json) selects the representation regardless of the Accept header
+	// if the path ends with it. The extension gets removed from the path before the handler is called.
+	Extension string
+
+	Handler http.Handler
+}
+
+func addVary(h http.Header, name string) {
+	for _, value := range h.Values("Vary") {
+		for _, v := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), name) || strings.TrimSpace(v) == "*" {
+				return
+			}
+		}
+	}
+	h.Add("Vary", name)
+}
+
+// stripExtension removes the extension from the path of the request.
+func stripExtension(r *http.Request, ext string) *http.Request {
+	r2 := r.Clone(r.Context())
+	r2.URL.Path = strings.TrimSuffix(r.URL.Path, ext)
+	if r.URL.RawPath != "" {
+		r2.URL.RawPath = strings.TrimSuffix(r.URL.RawPath, ext)
+	}
+	return r2
+}
+
+// Handler serves the representation which suits the request best. The representations
+// are listed in order of preference, which decides between equally acceptable representations.
+//
+// The selected media type is available to the handler via MediaType.
+// If no representation is acceptable then it responds with 406 Not Acceptable.
+func Handler(representations ...Representation) http.Handler {
+	offers := make([]string, 0, len(representations))
+	byMediaType := map[string]Representation{}
+	for _, rep := range representations {
+		offers = append(offers, rep.MediaType)
+		byMediaType[rep.MediaType] = rep
+	}
+
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			addVary(w.Header(), "Accept")
+
+			ext := path.Ext(r.URL.Path)
+			for _, rep := range representations {
+				if rep.Extension != "" && strings.EqualFold(rep.Extension, ext) {
+					r = stripExtension(r, ext)
+					serve(w, r, rep)
+					return
+				}
+			}
+
+			mediaType, ok := Best(r.Header.Get("Accept"), offers...)
+			if !ok {
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				w.WriteHeader(http.StatusNotAcceptable)
+				_, _ = w.Write([]byte("Not Acceptable. Available representations: " + strings.Join(offers, ", ") + "\n"))
+				return
+			}
+			serve(w, r, byMediaType[mediaType])
+		},
+	)
+}
+
+func serve(w http.ResponseWriter, r *http.Request, rep Representation) {
+	r = r.WithContext(context.WithValue(r.Context(), mediaTypeKey{}, rep.MediaType))
+	rep.Handler.ServeHTTP(w, r)
+}
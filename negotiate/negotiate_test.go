@@ -0,0 +1,71 @@
+package negotiate
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func areEqual[T comparable](t *testing.T, expected, actual T) {
+	if expected != actual {
+		t.Errorf("Expected: %v, Actual: %v", expected, actual)
+	}
+}
+
+func Test_Best(t *testing.T) {
+	for _, tc := range []struct {
+		accept   string
+		expected string
+		ok       bool
+	}{
+		{"", HTML, true},
+		{"*/*", HTML, true},
+		{"application/json", JSON, true},
+		{"text/html;q=0.8, application/json", JSON, true},
+		{"text/*;q=0.5, application/*;q=0.9", JSON, true},
+		{"application/*;q=0.9, application/json;q=0.1", Atom, true},
+		{"text/html, */*;q=0", HTML, true},
+		{"application/json;q=0, */*", HTML, true},
+		{"image/png", "", false},
+		{"text/html;q=0", "", false},
+		{"invalid, application/atom+xml", Atom, true},
+	} {
+		mediaType, ok := Best(tc.accept, HTML, JSON, Atom)
+		areEqual(t, tc.ok, ok)
+		areEqual(t, tc.expected, mediaType)
+	}
+}
+
+func Test_Handler(t *testing.T) {
+	write := func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, MediaType(r.Context())+" "+r.URL.Path)
+	}
+	handler := Handler(
+		Representation{MediaType: HTML, Handler: http.HandlerFunc(write)},
+		Representation{MediaType: JSON, Extension: ".json", Handler: http.HandlerFunc(write)},
+		Representation{MediaType: Atom, Extension: ".atom", Handler: http.HandlerFunc(write)},
+	)
+
+	for _, tc := range []struct {
+		target string
+		accept string
+		status int
+		body   string
+	}{
+		{"/posts", "text/html,application/xhtml+xml,*/*;q=0.8", 200, "text/html /posts"},
+		{"/posts", "application/json", 200, "application/json /posts"},
+		{"/posts.json", "text/html", 200, "application/json /posts"},
+		{"/posts.ATOM", "", 200, "application/atom+xml /posts"},
+		{"/posts.xml", "application/json", 200, "application/json /posts.xml"},
+		{"/posts", "image/png", 406, "Not Acceptable. Available representations: text/html, application/json, application/atom+xml\n"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, tc.target, nil)
+		r.Header.Set("Accept", tc.accept)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		areEqual(t, tc.status, w.Code)
+		areEqual(t, tc.body, w.Body.String())
+		areEqual(t, "Accept", w.Header().Get("Vary"))
+	}
+}
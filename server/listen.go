@@ -0,0 +1,115 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	unixPrefix    = "unix:"
+	systemdPrefix = "systemd"
+
+	// systemdFirstFD is the first file descriptor passed by systemd (SD_LISTEN_FDS_START).
+	systemdFirstFD = 3
+)
+
+// Listen creates a listener for an address as described by Config.Addr.
+// The socketMode is the file mode of a Unix socket.
+func Listen(addr string, socketMode os.FileMode) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(addr, unixPrefix):
+		return listenUnix(strings.TrimPrefix(addr, unixPrefix), socketMode)
+	case addr == systemdPrefix || strings.HasPrefix(addr, systemdPrefix+":"):
+		return listenSystemd(strings.TrimPrefix(strings.TrimPrefix(addr, systemdPrefix), ":"))
+	default:
+		if addr == "" {
+			addr = ":http"
+		}
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("error listening on %s: %w", addr, err)
+		}
+		return listener, nil
+	}
+}
+
+// removeStaleSocket removes the socket of a previous process which didn't clean up.
+// Sockets which still accept connections belong to a running process and are left alone,
+// as are all other files.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return nil
+	}
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("error listening on Unix socket %s: the socket is in use by another process", path)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return fmt.Errorf("error checking Unix socket %s: %w", path, err)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("error removing stale Unix socket %s: %w", path, err)
+	}
+	return nil
+}
+
+func listenUnix(path string, socketMode os.FileMode) (net.Listener, error) {
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("error listening on Unix socket %s: %w", path, err)
+	}
+	if err := os.Chmod(path, socketMode); err != nil {
+		_ = listener.Close()
+		return nil, fmt.Errorf("error setting the mode of Unix socket %s: %w", path, err)
+	}
+	return listener, nil
+}
+
+// listenSystemd returns a socket passed by systemd socket activation.
+// An empty name selects the first socket.
+func listenSystemd(name string) (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, errors.New("error listening on systemd socket: no sockets have been passed to this process")
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, errors.New("error listening on systemd socket: no sockets have been passed to this process")
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	index := 0
+	if name != "" {
+		index = -1
+		for i, n := range names {
+			if n == name && i < count {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return nil, fmt.Errorf("error listening on systemd socket: socket %s has not been passed to this process", name)
+		}
+	}
+
+	fd := systemdFirstFD + index
+	f := os.NewFile(uintptr(fd), fmt.Sprintf("systemd socket %d", fd))
+	defer f.Close()
+	listener, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("error listening on systemd socket %d: %w", fd, err)
+	}
+	return listener, nil
+}
@@ -0,0 +1,187 @@
+// Package server runs a http.Server with hardened defaults, which listens on a
+// TCP address, a Unix socket or a socket passed by systemd and shuts down gracefully.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/dusted-go/http/v6/middleware/healthz"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+const (
+	DefaultReadHeaderTimeout = 10 * time.Second
+	DefaultReadTimeout       = 30 * time.Second
+	DefaultWriteTimeout      = 60 * time.Second
+	DefaultIdleTimeout       = 120 * time.Second
+	DefaultMaxHeaderBytes    = 64 << 10
+	DefaultShutdownTimeout   = 30 * time.Second
+	DefaultSocketMode        = os.FileMode(0o660)
+)
+
+// Config configures a Server. Timeouts and limits which are zero get set to their defaults.
+type Config struct {
+	// Addr is where the server listens:
+	//
+	// - a TCP address (e.g. :8080 or 127.0.0.1:8080)
+	//
+	// - a Unix socket (e.g. unix:/run/app/http.sock)
+	//
+	// - a socket passed by systemd socket activation (systemd for the first socket
+	// or systemd:name for the socket with the FileDescriptorName=name)
+	Addr string
+
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+
+	// WriteTimeout limits the time to write a response. Handlers which stream
+	// responses for longer (e.g. server-sent events) require a negative value,
+	// which disables the timeout.
+	WriteTimeout   time.Duration
+	IdleTimeout    time.Duration
+	MaxHeaderBytes int
+
+	// TLSConfig enables TLS if it's not nil. It must provide the certificates
+	// (e.g. through tls.Manager.TLSConfig).
+	TLSConfig *tls.Config
+
+	// H2C serves HTTP/2 without TLS (h2c), both with prior knowledge and via the
+	// Upgrade header. It is meant for servers behind a TLS-terminating proxy which
+	// speaks HTTP/2 to its backends and is ignored if TLSConfig is set.
+	// Note that h2c connections are hijacked and therefore not drained by a graceful shutdown.
+	H2C bool
+
+	// MaxReadFrameSize and MaxUploadBufferPerConnection limit the frames and the flow control
+	// window of h2c connections (see http2.Server). Zero uses the defaults of the http2 package.
+	MaxReadFrameSize             uint32
+	MaxUploadBufferPerConnection int32
+
+	// SocketMode is the file mode of a Unix socket.
+	SocketMode os.FileMode
+
+	// Readiness starts failing when the server shuts down (see healthz.Shutdown).
+	Readiness       *healthz.Readiness
+	DrainDelay      time.Duration
+	ShutdownTimeout time.Duration
+
+	ErrorLog *log.Logger
+}
+
+func orDefault(d, def time.Duration) time.Duration {
+	switch {
+	case d < 0:
+		return 0
+	case d == 0:
+		return def
+	default:
+		return d
+	}
+}
+
+// Server is a http.Server which shuts down gracefully.
+type Server struct {
+	// HTTP is the underlying server, which can be customized before the server gets started.
+	HTTP *http.Server
+
+	config Config
+}
+
+// New creates a Server which serves the handler.
+func New(config Config, handler http.Handler) *Server {
+	if config.MaxHeaderBytes <= 0 {
+		config.MaxHeaderBytes = DefaultMaxHeaderBytes
+	}
+	if config.SocketMode == 0 {
+		config.SocketMode = DefaultSocketMode
+	}
+	config.ShutdownTimeout = orDefault(config.ShutdownTimeout, DefaultShutdownTimeout)
+	idleTimeout := orDefault(config.IdleTimeout, DefaultIdleTimeout)
+	if config.H2C && config.TLSConfig == nil {
+		handler = h2c.NewHandler(handler, &http2.Server{
+			IdleTimeout:                  idleTimeout,
+			MaxReadFrameSize:             config.MaxReadFrameSize,
+			MaxUploadBufferPerConnection: config.MaxUploadBufferPerConnection,
+		})
+	}
+
+	return &Server{
+		HTTP: &http.Server{
+			Addr:              config.Addr,
+			Handler:           handler,
+			TLSConfig:         config.TLSConfig,
+			ReadHeaderTimeout: orDefault(config.ReadHeaderTimeout, DefaultReadHeaderTimeout),
+			ReadTimeout:       orDefault(config.ReadTimeout, DefaultReadTimeout),
+			WriteTimeout:      orDefault(config.WriteTimeout, DefaultWriteTimeout),
+			IdleTimeout:       idleTimeout,
+			MaxHeaderBytes:    config.MaxHeaderBytes,
+			ErrorLog:          config.ErrorLog,
+		},
+		config: config,
+	}
+}
+
+// Shutdown returns the graceful shutdown sequence of the server.
+func (s *Server) Shutdown() *healthz.Shutdown {
+	return &healthz.Shutdown{
+		Server:     s.HTTP,
+		Readiness:  s.config.Readiness,
+		DrainDelay: s.config.DrainDelay,
+		Timeout:    s.config.ShutdownTimeout,
+	}
+}
+
+// Run listens on the configured address and serves requests until the process receives
+// SIGINT or SIGTERM, which starts the graceful shutdown. A second signal skips the drain delay.
+//
+// Run returns nil after a graceful shutdown.
+func (s *Server) Run() error {
+	listener, err := Listen(s.config.Addr, s.config.SocketMode)
+	if err != nil {
+		return err
+	}
+
+	received := make(chan os.Signal, 2)
+	signal.Notify(received, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(received)
+
+	served := make(chan error, 1)
+	go func() {
+		if s.HTTP.TLSConfig != nil {
+			served <- s.HTTP.ServeTLS(listener, "", "")
+		} else {
+			served <- s.HTTP.Serve(listener)
+		}
+	}()
+
+	select {
+	case err := <-served:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return fmt.Errorf("error serving HTTP requests: %w", err)
+	case <-received:
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-received:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// nolint: wrapcheck // Drain returns a descriptive error already
+	return s.Shutdown().Drain(ctx)
+}
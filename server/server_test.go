@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dusted-go/http/v6/middleware/headers"
+	"golang.org/x/net/http2"
+)
+
+func areEqual[T comparable](t *testing.T, expected, actual T) {
+	if expected != actual {
+		t.Errorf("Expected: %v, Actual: %v", expected, actual)
+	}
+}
+
+func Test_New_Defaults(t *testing.T) {
+	s := New(Config{WriteTimeout: -1}, http.NotFoundHandler())
+	areEqual(t, DefaultReadHeaderTimeout, s.HTTP.ReadHeaderTimeout)
+	areEqual(t, DefaultReadTimeout, s.HTTP.ReadTimeout)
+	areEqual(t, time.Duration(0), s.HTTP.WriteTimeout)
+	areEqual(t, DefaultIdleTimeout, s.HTTP.IdleTimeout)
+	areEqual(t, DefaultMaxHeaderBytes, s.HTTP.MaxHeaderBytes)
+	areEqual(t, DefaultShutdownTimeout, s.Shutdown().Timeout)
+}
+
+func Test_Listen_Unix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "http.sock")
+
+	// A stale socket must be replaced:
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = stale.Close()
+
+	listener, err := Listen(unixPrefix+path, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	areEqual(t, os.FileMode(0o600), info.Mode().Perm())
+
+	s := New(Config{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	go func() { _ = s.HTTP.Serve(listener) }()
+	defer s.HTTP.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Get("http://localhost/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	areEqual(t, "ok", string(body))
+
+	// Sockets of running processes must never be removed:
+	_, err = Listen(unixPrefix+path, 0o600)
+	areEqual(t, true, err != nil)
+	resp, err = client.Get("http://localhost/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	// Regular files must never be removed:
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = Listen(unixPrefix+file, 0o600)
+	areEqual(t, true, err != nil)
+	_, err = os.Stat(file)
+	areEqual(t, true, err == nil)
+}
+
+func Test_Listen_SystemdWithoutSockets(t *testing.T) {
+	t.Setenv("LISTEN_PID", "")
+	t.Setenv("LISTEN_FDS", "")
+	_, err := Listen("systemd", 0)
+	areEqual(t, true, err != nil)
+}
+
+func Test_New_H2C(t *testing.T) {
+	handler := headers.Override(map[string]string{
+		"Keep-Alive":      "timeout=5",
+		"X-Frame-Options": "DENY",
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = io.WriteString(w, r.Proto+" "+strconv.Itoa(len(body))+" "+w.Header().Get("Keep-Alive"))
+	}))
+	s := New(Config{H2C: true, MaxReadFrameSize: 1 << 20, MaxUploadBufferPerConnection: 1 << 20}, handler)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = s.HTTP.Serve(listener) }()
+	defer s.HTTP.Close()
+	url := "http://" + listener.Addr().String() + "/"
+	upload := strings.Repeat("x", 3<<20)
+
+	h2Client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+	for _, tc := range []struct {
+		client   *http.Client
+		expected string
+	}{
+		// Connection-specific headers must not be set on HTTP/2 responses:
+		{h2Client, "HTTP/2.0 3145728 "},
+		{&http.Client{}, "HTTP/1.1 3145728 timeout=5"},
+	} {
+		resp, err := tc.client.Post(url, "text/plain", strings.NewReader(upload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		areEqual(t, tc.expected, string(body))
+		areEqual(t, "DENY", resp.Header.Get("X-Frame-Options"))
+	}
+}
@@ -0,0 +1,152 @@
+package sse
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// subscriberBuffer is the number of events which are queued for a slow subscriber.
+const subscriberBuffer = 16
+
+// Broker fans out events to all subscribed streams and keeps the most recent
+// events in a replay buffer, so that reconnecting clients receive the events they missed.
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+	history     []Event
+	replaySize  int
+	heartbeat   time.Duration
+	nextID      uint64
+}
+
+// NewBroker creates a Broker which keeps up to replaySize events for replays
+// and sends a heartbeat to idle streams at the given interval (0 disables heartbeats).
+func NewBroker(replaySize int, heartbeat time.Duration) *Broker {
+	return &Broker{
+		subscribers: map[chan Event]struct{}{},
+		replaySize:  replaySize,
+		heartbeat:   heartbeat,
+	}
+}
+
+// Publish sends an event to all subscribers. Events without an ID get a sequential ID.
+//
+// Subscribers which can't keep up are disconnected instead of blocking the publisher.
+// Their clients reconnect and receive the missed events from the replay buffer.
+func (b *Broker) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	if e.ID == "" {
+		e.ID = strconv.FormatUint(b.nextID, 10)
+	}
+	if b.replaySize > 0 {
+		b.history = append(b.history, e)
+		if len(b.history) > b.replaySize {
+			b.history = b.history[len(b.history)-b.replaySize:]
+		}
+	}
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// replay returns the events after the one with the given ID. If the ID isn't in the
+// buffer anymore then all buffered events are returned, because some have been missed.
+func (b *Broker) replay(lastEventID string) []Event {
+	if lastEventID == "" {
+		return nil
+	}
+	for i, e := range b.history {
+		if e.ID == lastEventID {
+			return append([]Event{}, b.history[i+1:]...)
+		}
+	}
+	return append([]Event{}, b.history...)
+}
+
+// Subscribe registers a subscriber and returns the events to replay since lastEventID
+// and a channel of new events, which gets closed when the subscriber is too slow.
+// The unsubscribe function must be called when the subscriber is done.
+func (b *Broker) Subscribe(lastEventID string) ([]Event, <-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	replay := b.replay(lastEventID)
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+	return replay, ch, unsubscribe
+}
+
+// Subscribers returns the number of subscribers.
+func (b *Broker) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers)
+}
+
+// ServeHTTP streams the published events to the client until it disconnects,
+// starting with the events it missed according to its Last-Event-ID.
+func (b *Broker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	stream, err := NewStream(w, r)
+	if err != nil {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	replay, events, unsubscribe := b.Subscribe(stream.LastEventID())
+	defer unsubscribe()
+
+	for _, e := range replay {
+		if err := stream.Send(e); err != nil {
+			return
+		}
+	}
+
+	// The ticker is reset after every event, so that only idle streams get heartbeats:
+	var ticker *time.Ticker
+	var heartbeat <-chan time.Time
+	if b.heartbeat > 0 {
+		ticker = time.NewTicker(b.heartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	for {
+		select {
+		case <-stream.Done():
+			return
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := stream.Send(e); err != nil {
+				return
+			}
+			if ticker != nil {
+				ticker.Reset(b.heartbeat)
+			}
+		case <-heartbeat:
+			if err := stream.Comment("heartbeat"); err != nil {
+				return
+			}
+		}
+	}
+}
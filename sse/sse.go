@@ -0,0 +1,127 @@
+// Package sse streams server-sent events (text/event-stream) to browsers,
+// which receive them with the EventSource API.
+//
+// Streams are long-lived responses, which is why the WriteTimeout of the
+// http.Server must be disabled (e.g. server.Config{WriteTimeout: -1}).
+package sse
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event is a single server-sent event.
+type Event struct {
+	// ID is sent back by the client as Last-Event-ID when it reconnects.
+	ID string
+
+	// Event is the event type. Clients dispatch events without a type as message.
+	Event string
+
+	// Data is the payload. Multi-line data is sent as multiple data fields.
+	Data string
+
+	// Retry tells the client how long to wait before reconnecting.
+	Retry time.Duration
+}
+
+// sanitize removes line breaks, which would end the field, and NUL characters,
+// because clients ignore an id field which contains NUL.
+func sanitize(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "", "\x00", "").Replace(s)
+}
+
+// WriteTo writes the event in the text/event-stream format.
+func (e Event) WriteTo(w io.Writer) (int64, error) {
+	buf := &bytes.Buffer{}
+	if e.ID != "" {
+		buf.WriteString("id: " + sanitize(e.ID) + "\n")
+	}
+	if e.Event != "" {
+		buf.WriteString("event: " + sanitize(e.Event) + "\n")
+	}
+	if e.Retry > 0 {
+		buf.WriteString("retry: " + strconv.FormatInt(e.Retry.Milliseconds(), 10) + "\n")
+	}
+	data := strings.ReplaceAll(strings.ReplaceAll(e.Data, "\r\n", "\n"), "\r", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		buf.WriteString("data: " + line + "\n")
+	}
+	buf.WriteString("\n")
+	// nolint: wrapcheck // Must behave like the wrapped writer
+	return buf.WriteTo(w)
+}
+
+// Stream is a response which has been upgraded to an event stream.
+type Stream struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+	r       *http.Request
+}
+
+// NewStream upgrades the response to an event stream by sending the header.
+// It fails if the http.ResponseWriter doesn't support flushing.
+func NewStream(w http.ResponseWriter, r *http.Request) (*Stream, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("error creating event stream: the http.ResponseWriter does not implement http.Flusher")
+	}
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	// Stop reverse proxies such as nginx from buffering the stream:
+	h.Set("X-Accel-Buffering", "no")
+	h.Del("Content-Length")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	return &Stream{w: w, flusher: flusher, r: r}, nil
+}
+
+// LastEventID returns the ID of the last event which the client received before it reconnected.
+func (s *Stream) LastEventID() string {
+	return s.r.Header.Get("Last-Event-ID")
+}
+
+// Done is closed when the client disconnects.
+func (s *Stream) Done() <-chan struct{} {
+	return s.r.Context().Done()
+}
+
+func (s *Stream) write(f func(w io.Writer) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.r.Context().Err(); err != nil {
+		return fmt.Errorf("error writing to event stream: %w", err)
+	}
+	if err := f(s.w); err != nil {
+		return fmt.Errorf("error writing to event stream: %w", err)
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// Send writes an event and flushes it to the client.
+func (s *Stream) Send(e Event) error {
+	return s.write(func(w io.Writer) error {
+		_, err := e.WriteTo(w)
+		return err
+	})
+}
+
+// Comment writes a comment, which clients ignore. Comments are used as heartbeats,
+// which keep idle connections open and detect disconnected clients.
+func (s *Stream) Comment(text string) error {
+	return s.write(func(w io.Writer) error {
+		_, err := io.WriteString(w, ": "+sanitize(text)+"\n\n")
+		return err
+	})
+}
@@ -0,0 +1,131 @@
+package sse
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func areEqual[T comparable](t *testing.T, expected, actual T) {
+	if expected != actual {
+		t.Errorf("Expected: %v, Actual: %v", expected, actual)
+	}
+}
+
+func Test_Event_WriteTo(t *testing.T) {
+	sb := &strings.Builder{}
+	_, err := Event{ID: "7", Event: "update\n", Data: "line 1\r\nline 2", Retry: 3 * time.Second}.WriteTo(sb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	areEqual(t, "id: 7\nevent: update\nretry: 3000\ndata: line 1\ndata: line 2\n\n", sb.String())
+
+	// Clients ignore IDs which contain NUL:
+	sb.Reset()
+	_, err = Event{ID: "7\x00", Data: "a"}.WriteTo(sb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	areEqual(t, "id: 7\ndata: a\n\n", sb.String())
+}
+
+// readEvent reads the lines of the next event or comment.
+func readEvent(t *testing.T, r *bufio.Reader) string {
+	lines := []string{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line == "\n" {
+			return strings.Join(lines, "|")
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+}
+
+func Test_Broker(t *testing.T) {
+	broker := NewBroker(2, 50*time.Millisecond)
+	broker.Publish(Event{Data: "a"})
+	broker.Publish(Event{Data: "b"})
+	broker.Publish(Event{Data: "c"})
+
+	server := httptest.NewServer(broker)
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Last-Event-ID", "2")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	areEqual(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	body := bufio.NewReader(resp.Body)
+	areEqual(t, "id: 3|data: c", readEvent(t, body))
+
+	for broker.Subscribers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	broker.Publish(Event{Event: "ping", Data: "d"})
+	areEqual(t, "id: 4|event: ping|data: d", readEvent(t, body))
+	areEqual(t, ": heartbeat", readEvent(t, body))
+
+	// Disconnecting the client must unsubscribe it:
+	resp.Body.Close()
+	deadline := time.Now().Add(time.Second)
+	for broker.Subscribers() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	areEqual(t, 0, broker.Subscribers())
+}
+
+func Test_Broker_ReplayOfExpiredID(t *testing.T) {
+	broker := NewBroker(2, 0)
+	for _, data := range []string{"a", "b", "c"} {
+		broker.Publish(Event{Data: data})
+	}
+	replay, _, unsubscribe := broker.Subscribe("1")
+	defer unsubscribe()
+	areEqual(t, 2, len(replay))
+	areEqual(t, "b", replay[0].Data)
+
+	replay, _, unsubscribe2 := broker.Subscribe("")
+	defer unsubscribe2()
+	areEqual(t, 0, len(replay))
+}
+
+func Test_Broker_HeartbeatOnlyWhenIdle(t *testing.T) {
+	broker := NewBroker(0, 200*time.Millisecond)
+	server := httptest.NewServer(broker)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body := bufio.NewReader(resp.Body)
+
+	for broker.Subscribers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	go func() {
+		for i := 0; i < 10; i++ {
+			broker.Publish(Event{Data: "x"})
+			time.Sleep(50 * time.Millisecond)
+		}
+	}()
+	for i := 1; i <= 10; i++ {
+		areEqual(t, "id: "+strconv.Itoa(i)+"|data: x", readEvent(t, body))
+	}
+	areEqual(t, ": heartbeat", readEvent(t, body))
+}
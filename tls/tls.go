@@ -0,0 +1,120 @@
+// Package tls obtains and renews TLS certificates automatically from an ACME
+// certificate authority such as Let's Encrypt.
+//
+// Certificates are requested on the first TLS handshake for a host and renewed
+// in the background before they expire. Domains are validated with the tls-alpn-01
+// challenge on the TLS port and, if the HTTP server serves the Challenges middleware,
+// with the http-01 challenge on port 80.
+//
+// The http-01 challenge must be answered over plain HTTP, which is why the
+// HTTP server should exempt the challenge path from redirects:
+//
+//	manager, err := tls.New(tls.Config{Hosts: []string{"example.org"}, CacheDir: "/var/cache/certs"})
+//	...
+//	httpHandler := redirect.ForceHTTPSWith(redirect.HTTPSOptions{ExemptACMEChallenges: true})(
+//		manager.Challenges(app))
+//	go http.ListenAndServe(":80", httpHandler)
+//	server := &http.Server{Addr: ":443", Handler: app, TLSConfig: manager.TLSConfig()}
+//	server.ListenAndServeTLS("", "")
+package tls
+
+import (
+	cryptotls "crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	// LetsEncryptURL is the directory URL of the Let's Encrypt production environment.
+	LetsEncryptURL = acme.LetsEncryptURL
+
+	// LetsEncryptStagingURL is the directory URL of the Let's Encrypt staging environment,
+	// which has much higher rate limits, but issues certificates which aren't trusted by browsers.
+	LetsEncryptStagingURL = "https://acme-staging-v02.api.letsencrypt.org/directory"
+)
+
+// Config configures a Manager.
+type Config struct {
+	// Hosts are the host names for which certificates get requested.
+	// Handshakes for any other host fail, which prevents exhausting the CA's rate limits.
+	Hosts []string
+
+	// Email is the contact address of the ACME account, which is used
+	// by the CA to send notifications about expiring certificates.
+	Email string
+
+	// CacheDir is the directory where the account key and certificates are stored.
+	// Certificates are only kept in memory if it's empty, which should be avoided in
+	// production, because every restart would request new certificates.
+	CacheDir string
+
+	// DirectoryURL is the URL of the ACME directory. It defaults to LetsEncryptURL.
+	DirectoryURL string
+
+	// RootCAs are trusted when connecting to the ACME directory, which allows to use
+	// a local test CA such as Pebble. The system roots are used if it's nil.
+	RootCAs *x509.CertPool
+
+	// RenewBefore is how early certificates are renewed before they expire. It defaults to 30 days.
+	RenewBefore time.Duration
+}
+
+// Manager obtains, caches and renews certificates.
+type Manager struct {
+	autocert *autocert.Manager
+}
+
+// New creates a Manager. Creating a Manager implies agreeing to the CA's terms of service.
+func New(config Config) (*Manager, error) {
+	if len(config.Hosts) == 0 {
+		return nil, errors.New("error creating tls.Manager: at least one host is required")
+	}
+
+	client := &acme.Client{DirectoryURL: config.DirectoryURL}
+	if config.RootCAs != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &cryptotls.Config{
+			RootCAs:    config.RootCAs,
+			MinVersion: cryptotls.VersionTLS12,
+		}
+		client.HTTPClient = &http.Client{Transport: transport}
+	}
+
+	m := &autocert.Manager{
+		Prompt:      autocert.AcceptTOS,
+		HostPolicy:  autocert.HostWhitelist(config.Hosts...),
+		Email:       config.Email,
+		RenewBefore: config.RenewBefore,
+		Client:      client,
+	}
+	if config.CacheDir != "" {
+		m.Cache = autocert.DirCache(config.CacheDir)
+	}
+	return &Manager{autocert: m}, nil
+}
+
+// GetCertificate returns the certificate for the server name of a TLS handshake
+// and answers tls-alpn-01 challenges. It can be used as tls.Config.GetCertificate.
+func (m *Manager) GetCertificate(hello *cryptotls.ClientHelloInfo) (*cryptotls.Certificate, error) {
+	// nolint: wrapcheck // The error is returned from the TLS handshake as is.
+	return m.autocert.GetCertificate(hello)
+}
+
+// TLSConfig returns a TLS configuration for a http.Server, which supports
+// HTTP/2 and the tls-alpn-01 challenge.
+func (m *Manager) TLSConfig() *cryptotls.Config {
+	config := m.autocert.TLSConfig()
+	config.MinVersion = cryptotls.VersionTLS12
+	return config
+}
+
+// Challenges is a middleware which answers http-01 challenges and passes all other requests on to next.
+// Using it enables the http-01 challenge in addition to the tls-alpn-01 challenge.
+func (m *Manager) Challenges(next http.Handler) http.Handler {
+	return m.autocert.HTTPHandler(next)
+}
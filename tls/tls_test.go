@@ -0,0 +1,121 @@
+package tls
+
+import (
+	cryptotls "crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func areEqual[T comparable](t *testing.T, expected, actual T) {
+	if expected != actual {
+		t.Errorf("Expected: %v, Actual: %v", expected, actual)
+	}
+}
+
+func Test_New_RequiresHosts(t *testing.T) {
+	_, err := New(Config{})
+	areEqual(t, true, err != nil)
+}
+
+func Test_Manager_TLSConfig(t *testing.T) {
+	m, err := New(Config{Hosts: []string{"example.org"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := m.TLSConfig()
+	areEqual(t, uint16(cryptotls.VersionTLS12), config.MinVersion)
+	areEqual(t, "acme-tls/1", config.NextProtos[len(config.NextProtos)-1])
+
+	_, err = m.GetCertificate(&cryptotls.ClientHelloInfo{ServerName: "other.org"})
+	areEqual(t, true, err != nil)
+}
+
+func Test_Manager_Challenges(t *testing.T) {
+	m, err := New(Config{Hosts: []string{"example.org"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := m.Challenges(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.org/", nil))
+	areEqual(t, http.StatusTeapot, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.org/.well-known/acme-challenge/x", nil))
+	areEqual(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://other.org/.well-known/acme-challenge/x", nil))
+	areEqual(t, http.StatusForbidden, w.Code)
+}
+
+// Test_Pebble obtains a certificate from a local Pebble test server
+// (https://github.com/letsencrypt/pebble), e.g. started with:
+//
+//	PEBBLE_VA_ALWAYS_VALID=1 pebble -config test/config/pebble-config.json
+//
+// It only runs if PEBBLE_DIRECTORY_URL (e.g. https://localhost:14000/dir) and
+// PEBBLE_CA_CERT (the path of Pebble's test/certs/pebble.minica.pem) are set.
+// PEBBLE_HTTP_ADDR is where the http-01 challenges are served (default :5002).
+func Test_Pebble(t *testing.T) {
+	directoryURL := os.Getenv("PEBBLE_DIRECTORY_URL")
+	caCert := os.Getenv("PEBBLE_CA_CERT")
+	if directoryURL == "" || caCert == "" {
+		t.Skip("PEBBLE_DIRECTORY_URL and PEBBLE_CA_CERT are not set")
+	}
+	httpAddr := os.Getenv("PEBBLE_HTTP_ADDR")
+	if httpAddr == "" {
+		httpAddr = ":5002"
+	}
+
+	pem, err := os.ReadFile(caCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pem) {
+		t.Fatal("invalid CA certificate")
+	}
+
+	m, err := New(Config{
+		Hosts:        []string{"localhost"},
+		CacheDir:     t.TempDir(),
+		DirectoryURL: directoryURL,
+		RootCAs:      roots,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", httpAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{
+		Handler:           m.Challenges(http.NotFoundHandler()),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() { _ = server.Serve(listener) }()
+	defer server.Close()
+
+	cert, err := m.GetCertificate(&cryptotls.ClientHelloInfo{ServerName: "localhost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	areEqual(t, "localhost", cert.Leaf.DNSNames[0])
+
+	// The second handshake must be served from the cache:
+	cached, err := m.GetCertificate(&cryptotls.ClientHelloInfo{ServerName: "localhost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	areEqual(t, cert.Leaf.SerialNumber.String(), cached.Leaf.SerialNumber.String())
+}
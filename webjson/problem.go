@@ -0,0 +1,78 @@
+package webjson
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Problem describes an error in the format of RFC 9457 (problem details for HTTP APIs).
+type Problem struct {
+	// Type is a URI which identifies the problem type. It defaults to about:blank.
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	// Errors is an extension member which lists invalid fields.
+	Errors []FieldError `json:"errors,omitempty"`
+
+	// Extensions are additional members of the problem details object.
+	Extensions map[string]any `json:"-"`
+}
+
+// NewProblem creates a Problem with the title of the status code.
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// ProblemFor returns the Problem which describes an error to the client. The details of
+// errors other than *DecodeError are not exposed, because they might reveal internals.
+func ProblemFor(err error) *Problem {
+	var decodeErr *DecodeError
+	if errors.As(err, &decodeErr) {
+		return decodeErr.Problem()
+	}
+	return NewProblem(http.StatusInternalServerError, "")
+}
+
+// MarshalJSON adds the Extensions to the members of the problem details object.
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	type problem Problem
+	data, err := json.Marshal((*problem)(p))
+	if err != nil || len(p.Extensions) == 0 {
+		// nolint: wrapcheck // Called by the json package, which wraps the error
+		return data, err
+	}
+
+	members := map[string]any{}
+	for name, value := range p.Extensions {
+		members[name] = value
+	}
+	// The standard members take precedence over extensions with the same name:
+	standard := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &standard); err != nil {
+		return nil, fmt.Errorf("error merging problem extensions: %w", err)
+	}
+	for name, value := range standard {
+		members[name] = value
+	}
+	// nolint: wrapcheck // Called by the json package, which wraps the error
+	return json.Marshal(members)
+}
+
+// WriteProblem writes the problem details as application/problem+json.
+// The status code defaults to 500 Internal Server Error.
+func WriteProblem(w http.ResponseWriter, p *Problem) error {
+	status := p.Status
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	return write(w, ProblemContentType, status, p, false)
+}
@@ -0,0 +1,229 @@
+// Package webjson decodes JSON request bodies and writes JSON responses,
+// including RFC 9457 problem details (application/problem+json).
+package webjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	ContentType        = "application/json; charset=utf-8"
+	ProblemContentType = "application/problem+json; charset=utf-8"
+
+	// DefaultMaxBodySize is used by Decode if DecodeOptions.MaxBodySize is zero.
+	DefaultMaxBodySize int64 = 1 << 20
+)
+
+// DecodeOptions configures Decode.
+type DecodeOptions struct {
+	// MaxBodySize limits the size of the request body. It defaults to DefaultMaxBodySize
+	// and a negative value disables the limit. A lower limit which has been set with
+	// firewall.LimitRequestSize takes precedence.
+	MaxBodySize int64
+
+	// DisallowUnknownFields rejects objects with keys which don't match any field of the target.
+	DisallowUnknownFields bool
+}
+
+// FieldError describes an invalid value of a single field.
+type FieldError struct {
+	// Field is the path of the field (e.g. address.zip).
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// DecodeError is returned by Decode if the request body is not acceptable.
+type DecodeError struct {
+	// Status is the HTTP status code which describes the error best
+	// (400 Bad Request, 413 Payload Too Large or 415 Unsupported Media Type).
+	Status  int
+	Message string
+
+	// Field is set if the error can be attributed to a single field.
+	Field string
+
+	err error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("error decoding JSON request body: %s: %s", e.Field, e.Message)
+	}
+	return "error decoding JSON request body: " + e.Message
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.err
+}
+
+// Problem returns the problem details which describe the error to the client.
+func (e *DecodeError) Problem() *Problem {
+	p := NewProblem(e.Status, e.Message)
+	if e.Field != "" {
+		p.Errors = []FieldError{{Field: e.Field, Message: e.Message}}
+	}
+	return p
+}
+
+// isJSON reports whether the Content-Type is application/json or any +json media type.
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" ||
+		(strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json"))
+}
+
+// position returns the line and column of the byte which precedes the offset,
+// which is the invalid character of a json.SyntaxError.
+func position(data []byte, offset int64) (int, int) {
+	if offset > 0 {
+		offset--
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
+
+// typeName returns a description of a JSON type for error messages.
+func typeName(goType string) string {
+	switch {
+	case strings.HasPrefix(goType, "int"), strings.HasPrefix(goType, "uint"):
+		return "an integer"
+	case strings.HasPrefix(goType, "float"):
+		return "a number"
+	case goType == "string":
+		return "a string"
+	case goType == "bool":
+		return "a boolean"
+	case strings.HasPrefix(goType, "[]"), strings.HasPrefix(goType, "["):
+		return "an array"
+	default:
+		return "an object"
+	}
+}
+
+// newDecodeError translates the errors of the json package into DecodeErrors.
+func newDecodeError(err error, data []byte) *DecodeError {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		line, column := position(data, syntaxErr.Offset)
+		return &DecodeError{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("malformed JSON at line %d, column %d", line, column),
+			err:     err,
+		}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &DecodeError{Status: http.StatusBadRequest, Message: "malformed JSON: unexpected end of input", err: err}
+	case errors.As(err, &typeErr):
+		return &DecodeError{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("must be %s, but is a JSON %s", typeName(typeErr.Type.String()), typeErr.Value),
+			Field:   typeErr.Field,
+			err:     err,
+		}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field, unquoteErr := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+		if unquoteErr != nil {
+			field = strings.TrimPrefix(err.Error(), "json: unknown field ")
+		}
+		return &DecodeError{Status: http.StatusBadRequest, Message: "unknown field", Field: field, err: err}
+	default:
+		return &DecodeError{Status: http.StatusBadRequest, Message: err.Error(), err: err}
+	}
+}
+
+// Decode decodes the JSON request body into v.
+//
+// All errors which are caused by the client are returned as *DecodeError,
+// which can be sent back with WriteProblem(w, err.Problem()).
+func Decode(w http.ResponseWriter, r *http.Request, v any, opts DecodeOptions) error {
+	// Rejecting other content types prevents cross-site requests with
+	// JSON payloads, which browsers would send as text/plain without a preflight:
+	if !isJSON(r.Header.Get("Content-Type")) {
+		return &DecodeError{
+			Status:  http.StatusUnsupportedMediaType,
+			Message: "Content-Type must be application/json",
+		}
+	}
+
+	maxBodySize := opts.MaxBodySize
+	if maxBodySize == 0 {
+		maxBodySize = DefaultMaxBodySize
+	}
+	body := r.Body
+	if maxBodySize > 0 {
+		body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		// MaxBytesReader returns an unexported error type before Go 1.19:
+		if strings.Contains(err.Error(), "request body too large") {
+			return &DecodeError{
+				Status:  http.StatusRequestEntityTooLarge,
+				Message: "request body is too large",
+				err:     err,
+			}
+		}
+		return fmt.Errorf("error reading JSON request body: %w", err)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return &DecodeError{Status: http.StatusBadRequest, Message: "request body must not be empty"}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if opts.DisallowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(v); err != nil {
+		return newDecodeError(err, data)
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return &DecodeError{Status: http.StatusBadRequest, Message: "request body must contain a single JSON value"}
+	}
+	return nil
+}
+
+func write(w http.ResponseWriter, contentType string, status int, v any, pretty bool) error {
+	// Encode into a buffer first, so that an encoding error doesn't leave a half written response:
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	if pretty {
+		encoder.SetIndent("", "  ")
+	}
+	if err := encoder.Encode(v); err != nil {
+		return fmt.Errorf("error encoding JSON response: %w", err)
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	if _, err := buf.WriteTo(w); err != nil {
+		return fmt.Errorf("error writing JSON response: %w", err)
+	}
+	return nil
+}
+
+// Write writes v as a JSON response with the given status code.
+func Write(w http.ResponseWriter, status int, v any) error {
+	return write(w, ContentType, status, v, false)
+}
+
+// WritePretty is the same as Write, except that the JSON is indented for humans.
+func WritePretty(w http.ResponseWriter, status int, v any) error {
+	return write(w, ContentType, status, v, true)
+}
@@ -0,0 +1,116 @@
+package webjson
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dusted-go/http/v6/middleware/firewall"
+)
+
+func areEqual[T comparable](t *testing.T, expected, actual T) {
+	if expected != actual {
+		t.Errorf("Expected: %v, Actual: %v", expected, actual)
+	}
+}
+
+type address struct {
+	Zip string `json:"zip"`
+}
+
+type person struct {
+	Name    string  `json:"name"`
+	Age     int     `json:"age"`
+	Address address `json:"address"`
+}
+
+func decode(body, contentType string, opts DecodeOptions) (*person, *DecodeError) {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+	p := &person{}
+	err := Decode(httptest.NewRecorder(), r, p, opts)
+	if err == nil {
+		return p, nil
+	}
+	decodeErr := &DecodeError{}
+	if !errors.As(err, &decodeErr) {
+		panic(err)
+	}
+	return nil, decodeErr
+}
+
+func Test_Decode(t *testing.T) {
+	p, err := decode(`{"name":"Ann","age":42,"address":{"zip":"1234"}}`, "application/json; charset=utf-8", DecodeOptions{})
+	areEqual(t, true, err == nil)
+	areEqual(t, "Ann", p.Name)
+	areEqual(t, "1234", p.Address.Zip)
+}
+
+func Test_Decode_Errors(t *testing.T) {
+	for _, tc := range []struct {
+		body        string
+		contentType string
+		opts        DecodeOptions
+		status      int
+		field       string
+		message     string
+	}{
+		{`{}`, "text/plain", DecodeOptions{}, 415, "", "Content-Type must be application/json"},
+		{``, "application/json", DecodeOptions{}, 400, "", "request body must not be empty"},
+		{"{\n  \"name\": x}", "application/json", DecodeOptions{}, 400, "", "malformed JSON at line 2, column 11"},
+		{`{"name":`, "application/json", DecodeOptions{}, 400, "", "malformed JSON: unexpected end of input"},
+		{`{"age":"old"}`, "application/json", DecodeOptions{}, 400, "age", "must be an integer, but is a JSON string"},
+		{`{"address":{"zip":1}}`, "application/merge-patch+json", DecodeOptions{}, 400, "address.zip", "must be a string, but is a JSON number"},
+		{`{"nick":"A"}`, "application/json", DecodeOptions{DisallowUnknownFields: true}, 400, "nick", "unknown field"},
+		{`{}{}`, "application/json", DecodeOptions{}, 400, "", "request body must contain a single JSON value"},
+		{`{"name":"Ann"}`, "application/json", DecodeOptions{MaxBodySize: 5}, 413, "", "request body is too large"},
+	} {
+		_, err := decode(tc.body, tc.contentType, tc.opts)
+		if err == nil {
+			t.Errorf("Expected an error for %s", tc.body)
+			continue
+		}
+		areEqual(t, tc.status, err.Status)
+		areEqual(t, tc.field, err.Field)
+		areEqual(t, tc.message, err.Message)
+	}
+}
+
+func Test_Decode_LimitRequestSize(t *testing.T) {
+	var err error
+	handler := firewall.LimitRequestSize(5)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err = Decode(w, r, &person{}, DecodeOptions{})
+	}))
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"Ann"}`))
+	r.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	areEqual(t, http.StatusRequestEntityTooLarge, ProblemFor(err).Status)
+}
+
+func Test_WriteProblem(t *testing.T) {
+	p := NewProblem(http.StatusBadRequest, "invalid input")
+	p.Errors = []FieldError{{Field: "age", Message: "must be an integer"}}
+	p.Extensions = map[string]any{"traceId": "abc", "status": 999}
+
+	w := httptest.NewRecorder()
+	if err := WriteProblem(w, p); err != nil {
+		t.Fatal(err)
+	}
+	areEqual(t, http.StatusBadRequest, w.Code)
+	areEqual(t, ProblemContentType, w.Header().Get("Content-Type"))
+	areEqual(t,
+		`{"detail":"invalid input","errors":[{"field":"age","message":"must be an integer"}],"status":400,"title":"Bad Request","traceId":"abc"}`+"\n",
+		w.Body.String())
+}
+
+func Test_WritePretty(t *testing.T) {
+	w := httptest.NewRecorder()
+	if err := WritePretty(w, http.StatusCreated, map[string]int{"id": 1}); err != nil {
+		t.Fatal(err)
+	}
+	areEqual(t, http.StatusCreated, w.Code)
+	areEqual(t, ContentType, w.Header().Get("Content-Type"))
+	areEqual(t, "{\n  \"id\": 1\n}\n", w.Body.String())
+}